@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tactix/book"
+	"tactix/engine"
+)
+
+const bookUsage = `Usage: tactix book build <games.pgn...> [flags]
+
+Builds an opening book from PGN games. The book is written as lines of moves,
+as read by the engine, or as a Polyglot book when the output ends in .bin.
+
+Flags:
+`
+
+// bookCommand runs "tactix book ...", it returns the exit code
+func bookCommand(args []string) int {
+	if len(args) == 0 || args[0] != "build" {
+		fmt.Fprint(os.Stderr, bookUsage)
+		return 2
+	}
+
+	options := book.DefaultOptions()
+	flags := flag.NewFlagSet("book build", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, bookUsage)
+		flags.PrintDefaults()
+	}
+	flags.IntVar(&options.Depth, "depth", options.Depth, "plies of each game to add")
+	flags.IntVar(&options.MinGames, "min-games", options.MinGames, "leave out moves played in fewer games")
+	flags.IntVar(&options.MinElo, "min-elo", options.MinElo, "leave out games with a player rated lower")
+	results := flags.String("results", strings.Join(options.Results, ","), "results of the games to add")
+	output := flags.String("o", "-", "output file, - for standard output")
+	format := flags.String("format", "", "lines or polyglot, by default polyglot for .bin files")
+
+	// Flags may come after the file names, as in "book build games.pgn -depth 16"
+	var files []string
+	rest := args[1:]
+	for {
+		if err := flags.Parse(rest); err != nil {
+			return 2
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		files = append(files, flags.Arg(0))
+		rest = flags.Args()[1:]
+	}
+	if len(files) == 0 {
+		flags.Usage()
+		return 2
+	}
+	options.Results = strings.Split(*results, ",")
+
+	if *format == "" {
+		*format = "lines"
+		if filepath.Ext(*output) == ".bin" {
+			*format = "polyglot"
+		}
+	}
+	if *format != "lines" && *format != "polyglot" {
+		fmt.Fprintln(os.Stderr, "unknown book format:", *format)
+		return 2
+	}
+
+	builder := book.NewBuilder(options)
+	for _, file := range files {
+		if err := addGames(builder, file); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if err := writeBook(builder.Book(), *output, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "%d games added, %d games left out\n", builder.Games, builder.Skipped)
+	return 0
+}
+
+func addGames(builder *book.Builder, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Broken games are reported, but don't stop the build
+	errs := builder.AddGames(file)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+	}
+	return nil
+}
+
+func writeBook(openingBook *engine.OpeningBook, path, format string) (err error) {
+	// The entries are built first, such that a book which can't be written leaves no empty file behind
+	var entries []engine.PolyglotEntry
+	if format != "lines" {
+		if entries, err = openingBook.PolyglotEntries(); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = file
+	}
+
+	if format == "lines" {
+		return openingBook.WriteLines(w)
+	}
+	return engine.WritePolyglotBook(w, entries)
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"flag"
+	"os"
+
 	"tactix/engine"
 )
 
 func main() {
-	engine.RunCommLoop()
+	if len(os.Args) > 1 && os.Args[1] == "book" {
+		os.Exit(bookCommand(os.Args[2:]))
+	}
+
+	bookFile := flag.String("book", "", "opening book to use instead of the built in one, a Polyglot .bin book or lines of moves")
+	flag.Parse()
+
+	engine.RunCommLoop(*bookFile)
 }
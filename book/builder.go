@@ -0,0 +1,131 @@
+// Package book builds opening books from collections of games.
+package book
+
+import (
+	"io"
+	"slices"
+	"strconv"
+
+	"tactix/engine"
+	"tactix/pgn"
+)
+
+type Options struct {
+	Depth    int      // Plies of each game which are added to the book
+	MinGames int      // Moves played in fewer games are left out
+	MinElo   int      // Both players need at least this rating, 0 takes games without ratings too
+	Results  []string // Only games with these results are added
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Depth:    16,
+		MinGames: 1,
+		Results:  []string{pgn.WhiteWins, pgn.BlackWins, pgn.Draw},
+	}
+}
+
+// Builder collects the moves of games into a book.
+// A move is weighted by how the game went for the side which played it, a win counts 2, a draw 1 and a loss 0.
+type Builder struct {
+	options Options
+	book    *engine.OpeningBook
+
+	Games   int // Games added to the book
+	Skipped int // Games left out by the filters
+}
+
+func NewBuilder(options Options) *Builder {
+	return &Builder{options: options, book: engine.NewOpeningBook()}
+}
+
+// Add adds the game to the book, false if it was filtered out
+func (builder *Builder) Add(game *pgn.Game) bool {
+	if !builder.accepts(game) {
+		builder.Skipped++
+		return false
+	}
+	builder.Games++
+
+	pos := engine.FromStandardStartingPosition()
+	for i, ply := range game.Plies {
+		if i >= builder.options.Depth {
+			break
+		}
+		builder.book.Add(pos, ply.Move, resultWeight(game.Result, pos.ColorToMove))
+		pos.MakeMove(ply.Move)
+	}
+	return true
+}
+
+// AddGames adds every game read from the PGN, games which can't be read are skipped.
+// The errors of the skipped games are returned, reading only stops early when reading the input fails.
+func (builder *Builder) AddGames(r io.Reader) []error {
+	var errs []error
+	input := &inputReader{r: r}
+	reader := pgn.NewReader(input)
+	for {
+		game, err := reader.Read()
+		if err == io.EOF {
+			return errs
+		}
+		if err != nil {
+			errs = append(errs, err)
+			if input.err != nil {
+				return errs
+			}
+			continue
+		}
+		builder.Add(game)
+	}
+}
+
+// inputReader keeps the error of the input, to tell it apart from the errors of a broken game
+type inputReader struct {
+	r   io.Reader
+	err error
+}
+
+func (input *inputReader) Read(p []byte) (int, error) {
+	n, err := input.r.Read(p)
+	if err != nil && err != io.EOF {
+		input.err = err
+	}
+	return n, err
+}
+
+// Book is the book of the games added so far, without the moves played in fewer than MinGames games
+func (builder *Builder) Book() *engine.OpeningBook {
+	builder.book.Prune(builder.options.MinGames)
+	return builder.book
+}
+
+func (builder *Builder) accepts(game *pgn.Game) bool {
+	// The book is walked from the starting position, games from other positions would never be reached
+	if game.Tag("FEN") != "" {
+		return false
+	}
+	if !slices.Contains(builder.options.Results, game.Result) {
+		return false
+	}
+	if builder.options.MinElo > 0 {
+		for _, tag := range []string{"WhiteElo", "BlackElo"} {
+			elo, err := strconv.Atoi(game.Tag(tag))
+			if err != nil || elo < builder.options.MinElo {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func resultWeight(result string, color engine.Color) int {
+	switch {
+	case result == pgn.Draw:
+		return 1
+	case result == pgn.WhiteWins && color == engine.White, result == pgn.BlackWins && color == engine.Black:
+		return 2
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,226 @@
+package engine
+
+import "math/bits"
+
+// Precomputed attack tables, sliding pieces use fancy magic bitboards.
+// Reference: https://www.chessprogramming.org/Magic_Bitboards
+
+const (
+	FileABB Bitboard = 0x0101_0101_0101_0101
+	FileHBB Bitboard = FileABB << 7
+	Rank1BB Bitboard = 0xff
+	Rank8BB Bitboard = Rank1BB << 56
+)
+
+var (
+	knightAttacks [65]Bitboard
+	kingAttacks   [65]Bitboard
+	pawnAttacks   [2][65]Bitboard // Squares a pawn of the color attacks from the square
+
+	// Squares strictly between two squares on a line, and the full line through them. Empty if not on a line.
+	betweenBB [65][65]Bitboard
+	lineBB    [65][65]Bitboard
+
+	rookMagics   [65]magic
+	bishopMagics [65]magic
+)
+
+var (
+	rookDirections   = [4][2]int{{0, 1}, {0, -1}, {1, 0}, {-1, 0}}
+	bishopDirections = [4][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+type magic struct {
+	mask    Bitboard // Relevant occupancy, the edges are left out as they can't block anything
+	magic   uint64
+	shift   uint8
+	attacks []Bitboard
+}
+
+func (m *magic) index(occupied Bitboard) uint64 {
+	return (uint64(occupied&m.mask) * m.magic) >> m.shift
+}
+
+func init() {
+	initLeaperAttacks()
+	initLines()
+
+	// Fixed seed, such that the same magics are found on every run
+	rng := prng{state: 728_361_915}
+	initMagics(&rookMagics, rookDirections, &rng)
+	initMagics(&bishopMagics, bishopDirections, &rng)
+}
+
+// SquareBB is the bitboard with only the square set
+func SquareBB(sq Square) Bitboard {
+	return 1 << (sq - 1)
+}
+
+// Walks from the square in the direction, as long as it is on the board. Returns 0 when it leaves it.
+func offsetSquare(sq Square, fileStep, rankStep int) Square {
+	file := int(File(sq)) + fileStep
+	rank := int(Rank(sq)) + rankStep
+	if file < 1 || 8 < file || rank < 1 || 8 < rank {
+		return 0
+	}
+	return DeriveSquare(file, rank)
+}
+
+func initLeaperAttacks() {
+	knightSteps := [8][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps := [8][2]int{{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1}}
+
+	for sq := Square(1); sq <= 64; sq++ {
+		for _, step := range knightSteps {
+			if to := offsetSquare(sq, step[0], step[1]); to != 0 {
+				knightAttacks[sq] |= SquareBB(to)
+			}
+		}
+		for _, step := range kingSteps {
+			if to := offsetSquare(sq, step[0], step[1]); to != 0 {
+				kingAttacks[sq] |= SquareBB(to)
+			}
+		}
+		for _, fileStep := range []int{-1, 1} {
+			if to := offsetSquare(sq, fileStep, 1); to != 0 {
+				pawnAttacks[White][sq] |= SquareBB(to)
+			}
+			if to := offsetSquare(sq, fileStep, -1); to != 0 {
+				pawnAttacks[Black][sq] |= SquareBB(to)
+			}
+		}
+	}
+}
+
+func initLines() {
+	for sq := Square(1); sq <= 64; sq++ {
+		for _, dirs := range [][4][2]int{rookDirections, bishopDirections} {
+			for _, dir := range dirs {
+				fullLine := slidingAttacksSlow(sq, 0, [][2]int{dir, {-dir[0], -dir[1]}}) | SquareBB(sq)
+
+				var between Bitboard
+				for to := offsetSquare(sq, dir[0], dir[1]); to != 0; to = offsetSquare(to, dir[0], dir[1]) {
+					betweenBB[sq][to] = between
+					lineBB[sq][to] = fullLine
+					between |= SquareBB(to)
+				}
+			}
+		}
+	}
+}
+
+// Attacks of a sliding piece found by walking the rays, only used to set up the tables
+func slidingAttacksSlow(sq Square, occupied Bitboard, directions [][2]int) Bitboard {
+	var attacks Bitboard
+	for _, dir := range directions {
+		for to := offsetSquare(sq, dir[0], dir[1]); to != 0; to = offsetSquare(to, dir[0], dir[1]) {
+			attacks |= SquareBB(to)
+			if occupied.IsSet(to) {
+				break
+			}
+		}
+	}
+	return attacks
+}
+
+// initMagics finds a magic number for every square by trial and error,
+// such that every relevant occupancy is mapped to an index with the right attacks.
+func initMagics(table *[65]magic, directions [4][2]int, rng *prng) {
+	for sq := Square(1); sq <= 64; sq++ {
+		m := &table[sq]
+
+		edges := ((Rank1BB | Rank8BB) &^ rankBB(sq)) | ((FileABB | FileHBB) &^ fileBB(sq))
+		m.mask = slidingAttacksSlow(sq, 0, directions[:]) &^ edges
+		relevantBits := m.mask.Count()
+		m.shift = uint8(64 - relevantBits)
+
+		// Every subset of the mask, using the Carry-Rippler trick
+		size := 1 << relevantBits
+		occupancies := make([]Bitboard, 0, size)
+		reference := make([]Bitboard, 0, size)
+		var subset Bitboard
+		for {
+			occupancies = append(occupancies, subset)
+			reference = append(reference, slidingAttacksSlow(sq, subset, directions[:]))
+			subset = (subset - m.mask) & m.mask
+			if subset == 0 {
+				break
+			}
+		}
+
+		m.attacks = make([]Bitboard, size)
+		// The attempt an index was last written in, saves clearing the attacks between attempts
+		usedIn := make([]int, size)
+
+		for attempt := 1; ; attempt++ {
+			// Magics with few bits set work best
+			m.magic = rng.next() & rng.next() & rng.next()
+			if bits.OnesCount64((uint64(m.mask)*m.magic)>>56) < 6 {
+				continue
+			}
+
+			found := true
+			for i, occupied := range occupancies {
+				idx := m.index(occupied)
+				if usedIn[idx] < attempt {
+					usedIn[idx] = attempt
+					m.attacks[idx] = reference[i]
+				} else if m.attacks[idx] != reference[i] {
+					found = false
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+	}
+}
+
+func rankBB(sq Square) Bitboard {
+	return Rank1BB << (8 * (Rank(sq) - 1))
+}
+
+func fileBB(sq Square) Bitboard {
+	return FileABB << (File(sq) - 1)
+}
+
+func rookAttacks(sq Square, occupied Bitboard) Bitboard {
+	m := &rookMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func bishopAttacks(sq Square, occupied Bitboard) Bitboard {
+	m := &bishopMagics[sq]
+	return m.attacks[m.index(occupied)]
+}
+
+func queenAttacks(sq Square, occupied Bitboard) Bitboard {
+	return rookAttacks(sq, occupied) | bishopAttacks(sq, occupied)
+}
+
+// Squares attacked by any of the pawns of the color
+func pawnSetAttacks(color Color, pawns Bitboard) Bitboard {
+	if color == White {
+		return (pawns&^FileABB)<<7 | (pawns&^FileHBB)<<9
+	}
+	return (pawns&^FileHBB)>>7 | (pawns&^FileABB)>>9
+}
+
+// Attacks of a piece of the given type, pawns are not handled as their attacks depend on the color
+func pieceAttacks(ptype PType, sq Square, occupied Bitboard) Bitboard {
+	switch ptype {
+	case Knight:
+		return knightAttacks[sq]
+	case Bishop:
+		return bishopAttacks(sq, occupied)
+	case Rook:
+		return rookAttacks(sq, occupied)
+	case Queen:
+		return queenAttacks(sq, occupied)
+	case King:
+		return kingAttacks[sq]
+	default:
+		return 0
+	}
+}
@@ -12,6 +12,10 @@ type Bitboard uint64
 const (
 	FullBB  Bitboard = 0xffff_ffff_ffff_ffff
 	EmptyBB Bitboard = 0x0
+
+	// a1 is a dark square
+	DarkSquaresBB  Bitboard = 0xaa55_aa55_aa55_aa55
+	LightSquaresBB Bitboard = ^DarkSquaresBB
 )
 
 func BBFromSquares(squares ...Square) Bitboard {
@@ -34,21 +38,23 @@ func (bitboard Bitboard) IsSet(sq Square) bool {
 	return (bitboard & (1 << (sq - 1))) != 0
 }
 
-// Least significant bit
+// Least significant bit, as a 0-indexed bit position
 func (bitboard Bitboard) lsb() Square {
 	return Square(bits.TrailingZeros64(uint64(bitboard)))
 }
 
 func (bitboard *Bitboard) clearBit(sq Square) {
-	*bitboard ^= ^BBFromSquares(sq)
+	*bitboard &^= BBFromSquares(sq)
 }
 
+// Pop removes the lowest set square from the bitboard and returns it
 func (bitboard *Bitboard) Pop() Square {
 	if *bitboard == 0 {
 		panic("Pop called on empty bitboard,")
 	}
 
 	pos := bitboard.lsb()
+	*bitboard &= *bitboard - 1
 
 	return pos + 1
 }
@@ -3,6 +3,7 @@ package engine
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -25,9 +26,10 @@ const (
 	HelpMessage = `	Commands:
 	uci - Start th UCI protocol
 	d/print - Display the current board
-	move <move> - Make a move
+	move <moves...> - Make one or more moves in SAN or coordinates, e.g. "move e4 e5 Nf3" or "move e2e4"
+	moves - List the legal moves
 	perft <depth> - Run perft to a certain depth
-	position <fen> - Set the board to a fen string
+	position [startpos | fen <fen> | <fen>] [moves <moves...>] - Set the board
 	help - Print this help message
 	quit - Exit the program
 `
@@ -48,19 +50,29 @@ func NewComms() *Communication {
 	return &com
 }
 
-func RunCommLoop() {
+// RunCommLoop reads commands until "quit", bookFile replaces the built in book when it is not empty
+func RunCommLoop(bookFile string) {
 	fmt.Println(Banner)
 
 	comms := NewComms()
+	if bookFile != "" {
+		comms.uci.loadBookFile(bookFile)
+	}
 
 	for {
 		message, err := comms.reader.ReadString('\n')
+		if err == io.EOF {
+			// The GUI closed the input, handle it like "quit"
+			comms.uci.StopSearch()
+			break
+		}
 		if err != nil {
 			fmt.Println("Error reading input")
 			continue
 		}
-		message = strings.Trim(message, "\n")
+		message = strings.TrimSpace(message)
 		if message == "quit" {
+			comms.uci.StopSearch()
 			break
 		}
 
@@ -76,20 +88,19 @@ func (comm *Communication) handleCommand(message string) {
 
 	switch fields[0] {
 	// UCI commands
-	case "uci", "isready", "setoption", "register", "ucinewgame", "go", "position", "stop", "ponderhit":
+	case "uci", "debug", "isready", "setoption", "register", "ucinewgame", "go", "position", "stop", "ponderhit":
 		comm.uci.handleUCICommand(message)
 	// Custom commands
 	case "d", "print":
 		fmt.Println(comm.pos.String())
 	case "eval":
-		fmt.Println(Evaluate(comm.pos))
+		fmt.Println(EvaluateWhite(comm.pos))
 	case "move", "m":
 		comm.moveCommand(message)
 	case "perft":
 		comm.perftCommand(message)
 	case "moves":
-		moves := LegalMoves(comm.pos)
-		fmt.Println(moves.String())
+		comm.movesCommand()
 	case "help", "h":
 		comm.helpCommand()
 	default:
@@ -106,20 +117,19 @@ func (comm *Communication) moveCommand(message string) {
 		return
 	}
 
-	move, err := ParseUCIMove(comm.pos, msgParts[1])
-	if err != nil {
-		fmt.Println("Invalid move")
-		return
+	if err := MakeMoves(comm.pos, msgParts[1:]); err != nil {
+		fmt.Println(err)
 	}
+}
 
-	fmt.Println(move.String())
+func (comm *Communication) movesCommand() {
+	moves := LegalMoves(comm.pos)
 
-	if !IsMoveValid(comm.pos, move) {
-		fmt.Println("Move not legal")
-		return
+	sans := make([]string, len(moves))
+	for i, move := range moves {
+		sans[i] = comm.pos.SAN(move)
 	}
-
-	comm.pos.MakeMove(move)
+	fmt.Printf("Moves: %d\n%s\n", len(moves), strings.Join(sans, " "))
 }
 
 func (comm *Communication) perftCommand(message string) {
@@ -8,49 +8,76 @@ const (
 	RookValue   = 500
 	QueenValue  = 900
 
-	MobilityValue = 10
-
 	PositiveInfinity = 999_999
 	NegativeInfinity = -PositiveInfinity
+
+	DrawScore = 0
+
+	// Being checkmated at ply p scores -MateScore + p, such that faster mates score higher.
+	// Scores beyond the threshold are mate scores.
+	MateScore     = 100_000
+	MateThreshold = MateScore - MaxPly
 )
 
-// positive for white, negative for black, as it should be
+// Evaluate is the score from the side to move's point of view, as the negamax search needs it
 func Evaluate(pos *Position) int {
-	eval := 0
+	return who2move(pos.ColorToMove) * evaluate(pos, nil)
+}
 
-	if pos.Checkmate {
-		return PositiveInfinity * who2move(pos.ColorToMove)
-	}
+// EvaluateWhite is positive when White stands better and negative when Black does, for display
+func EvaluateWhite(pos *Position) int {
+	return evaluate(pos, nil)
+}
 
-	materialScore := materialScore(pos)
-	mobilityScore := mobilityScore(pos)
+// evaluate is the score from White's side, pawn structures are looked up in the pawn table if it is not nil
+func evaluate(pos *Position, pawns *PawnTable) int {
+	phase := gamePhase(pos)
 
-	eval = (materialScore + mobilityScore)
+	// Material and piece-square tables are summed up in MakeMove and UndoMove
+	eval := taper(pos.middlegame, pos.endgame, phase)
 
-	return eval
-}
+	// The attacks on the kings are collected while the mobility is counted
+	var attackers [2]kingAttackers
+	eval += mobilityScore(pos, phase, &attackers)
+	eval += kingSafetyScore(pos, phase, &attackers)
 
-func materialScore(pos *Position) (materialScore int) {
-	materialScore = PawnValue * (pos.PieceBitboard(WhitePiece(Pawn)).Count() - pos.PieceBitboard(BlackPiece(Pawn)).Count())
-	materialScore += KnightValue * (pos.PieceBitboard(WhitePiece(Knight)).Count() - pos.PieceBitboard(BlackPiece(Knight)).Count())
-	materialScore += BishopValue * (pos.PieceBitboard(WhitePiece(Bishop)).Count() - pos.PieceBitboard(BlackPiece(Bishop)).Count())
-	materialScore += RookValue * (pos.PieceBitboard(WhitePiece(Rook)).Count() - pos.PieceBitboard(BlackPiece(Rook)).Count())
-	materialScore += QueenValue * (pos.PieceBitboard(WhitePiece(Queen)).Count() - pos.PieceBitboard(BlackPiece(Queen)).Count())
+	eval += pawnScore(pos, pawns, phase)
 
-	return materialScore
+	return eval
 }
 
-func mobilityScore(pos *Position) int {
-	c2m := pos.ColorToMove
-
-	pos.ColorToMove = White
-	whiteMobility := len(LegalMoves(pos))
-	pos.ColorToMove = Black
-	blackMobility := len(LegalMoves(pos))
+// Bonus for each square a piece attacks, which is not taken by its own pieces or attacked by enemy pawns
+var (
+	mobilityMiddlegame = [6]int{Knight: 4, Bishop: 5, Rook: 2, Queen: 1}
+	mobilityEndgame    = [6]int{Knight: 4, Bishop: 5, Rook: 4, Queen: 2}
+)
 
-	pos.ColorToMove = c2m
+// mobilityScore counts the attacked squares from the attack tables, pins and checks are not taken into account.
+// The pieces attacking the zone around the enemy king are added to its attackers.
+func mobilityScore(pos *Position, phase int, attackers *[2]kingAttackers) int {
+	occupied := pos.AllPieces()
+
+	var middlegame, endgame int
+	for color := White; color <= Black; color++ {
+		them := color.opposite()
+		available := ^pos.ColorBitboard(color) &^ pawnSetAttacks(them, pos.pieceBitboards[them][Pawn])
+		zone := kingZone(pos.GetKingSquare(them))
+
+		sign := who2move(color)
+		for ptype := Knight; ptype <= Queen; ptype++ {
+			pieces := pos.pieceBitboards[color][ptype]
+			for pieces != 0 {
+				attacks := pieceAttacks(ptype, pieces.Pop(), occupied)
+				count := (attacks & available).Count()
+				middlegame += sign * count * mobilityMiddlegame[ptype]
+				endgame += sign * count * mobilityEndgame[ptype]
+
+				attackers[them].add(ptype, attacks&zone)
+			}
+		}
+	}
 
-	return MobilityValue * (whiteMobility - blackMobility)
+	return taper(middlegame, endgame, phase)
 }
 
 func who2move(c2m Color) int {
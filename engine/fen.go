@@ -128,7 +128,7 @@ func FromFEN(fen string) (*Position, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Invalid FEN: halfmove clock. \n" + err.Error())
 		}
-		pos.Rule50 = int8(hc)
+		pos.Rule50 = int16(hc)
 	} else {
 		pos.Rule50 = 0
 	}
@@ -144,10 +144,10 @@ func FromFEN(fen string) (*Position, error) {
 		pos.Ply = 1
 	}
 
-	pos.Checkmate = false
-	pos.Stalemate = false
-
 	pos.InitPieceBitboards()
+	pos.Hash = pos.ComputeHash()
+	pos.PawnHash = pos.ComputePawnHash()
+	pos.middlegame, pos.endgame = pos.ComputeScores()
 
 	return pos, nil
 }
@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// King safety, the pawns in front of the king, open files next to it, and the pieces attacking the squares around it.
+// It only counts in the middlegame, in the endgame the king is a piece like the others.
+
+type KingSafetyWeights struct {
+	// Bonus for a pawn of the king's side one and two ranks in front of the king, on the king's file and the files next to it
+	ShieldPawn [2]int
+	// Penalty for those files without a shield pawn
+	MissingShield int
+
+	// Penalty for a file next to the king, or its own file, without own pawns. Open files have no pawns at all.
+	SemiOpenFile int
+	OpenFile     int
+
+	// Attack units for each square of the king zone a piece attacks
+	AttackWeight [6]int
+	// The danger only counts with at least this many attackers, a lone piece can't mate
+	MinAttackers int
+	// Penalty by the attack units on the king zone
+	Danger [100]int
+}
+
+// KingSafety holds the weights used by the evaluation, it can be changed to tune them but not during a search.
+// LoadKingSafetyWeights and the KingSafetyFile option set it from a file.
+var KingSafety = DefaultKingSafety
+
+// The danger by attack units is the SafetyTable of the attack units scheme.
+// Reference: https://www.chessprogramming.org/King_Safety#Attack_Units
+var DefaultKingSafety = KingSafetyWeights{
+	ShieldPawn:    [2]int{10, 5},
+	MissingShield: -15,
+
+	SemiOpenFile: -10,
+	OpenFile:     -20,
+
+	AttackWeight: [6]int{Knight: 2, Bishop: 2, Rook: 3, Queen: 5},
+	MinAttackers: 2,
+	Danger: [100]int{
+		0, 0, 1, 2, 3, 5, 7, 9, 12, 15,
+		18, 22, 26, 30, 35, 39, 44, 50, 56, 62,
+		68, 75, 82, 85, 89, 97, 105, 113, 122, 131,
+		140, 150, 169, 180, 191, 202, 213, 225, 237, 248,
+		260, 272, 283, 295, 307, 319, 330, 342, 354, 366,
+		377, 389, 401, 412, 424, 436, 448, 459, 471, 483,
+		494, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+	},
+}
+
+// kingAttackers are the pieces attacking the zone around a king
+type kingAttackers struct {
+	count int
+	units int
+}
+
+func (attackers *kingAttackers) add(ptype PType, zoneAttacks Bitboard) {
+	if zoneAttacks == 0 {
+		return
+	}
+	attackers.count++
+	attackers.units += KingSafety.AttackWeight[ptype] * zoneAttacks.Count()
+}
+
+// The king zone is the king's square and the squares around it
+func kingZone(sq Square) Bitboard {
+	return kingAttacks[sq] | SquareBB(sq)
+}
+
+// kingSafetyScore is the safety of White's king minus the safety of Black's king
+func kingSafetyScore(pos *Position, phase int, attackers *[2]kingAttackers) int {
+	score := 0
+	for color := White; color <= Black; color++ {
+		safety := pawnShield(pos, color)
+
+		if attackers[color].count >= KingSafety.MinAttackers {
+			safety -= KingSafety.Danger[min(attackers[color].units, len(KingSafety.Danger)-1)]
+		}
+
+		score += who2move(color) * safety
+	}
+	return taper(score, 0, phase)
+}
+
+// pawnShield scores the pawns and the open files in front of the king of the color
+func pawnShield(pos *Position, color Color) int {
+	kingSquare := pos.GetKingSquare(color)
+	ours := pos.pieceBitboards[color][Pawn]
+	theirs := pos.pieceBitboards[color.opposite()][Pawn]
+
+	// The shield only protects a king which is still on its first two ranks
+	shielded := relativeRank(color, kingSquare) <= 2
+	inFront := passedPawnMaskBB[color][kingSquare]
+
+	score := 0
+	files := fileBB(kingSquare) | adjacentFilesBB[kingSquare]
+	for files != 0 {
+		file := fileBB(files.Pop())
+		files &^= file
+
+		switch {
+		case file&ours == 0 && file&theirs == 0:
+			score += KingSafety.OpenFile
+		case file&ours == 0:
+			score += KingSafety.SemiOpenFile
+		}
+
+		if !shielded {
+			continue
+		}
+		shield := file & inFront & ours
+		switch {
+		case shield&relativeRankBB(color, relativeRank(color, kingSquare)+1) != 0:
+			score += KingSafety.ShieldPawn[0]
+		case shield&relativeRankBB(color, relativeRank(color, kingSquare)+2) != 0:
+			score += KingSafety.ShieldPawn[1]
+		default:
+			score += KingSafety.MissingShield
+		}
+	}
+	return score
+}
+
+// The rank counted from the side of the color
+func relativeRankBB(color Color, rank int) Bitboard {
+	if color == Black {
+		rank = 9 - rank
+	}
+	return Rank1BB << (8 * (rank - 1))
+}
+
+var kingSafetyNames = []string{"shield pawn", "missing shield", "semi-open file", "open file", "attack weight", "min attackers", "danger"}
+
+// lookup gives the weights of the name, as written by Write
+func (weights *KingSafetyWeights) lookup(name string) []*int {
+	switch name {
+	case "shield pawn":
+		return pointers(weights.ShieldPawn[:])
+	case "missing shield":
+		return []*int{&weights.MissingShield}
+	case "semi-open file":
+		return []*int{&weights.SemiOpenFile}
+	case "open file":
+		return []*int{&weights.OpenFile}
+	case "attack weight":
+		return pointers(weights.AttackWeight[:])
+	case "min attackers":
+		return []*int{&weights.MinAttackers}
+	case "danger":
+		return pointers(weights.Danger[:])
+	}
+	return nil
+}
+
+func pointers(values []int) []*int {
+	result := make([]*int, len(values))
+	for i := range values {
+		result[i] = &values[i]
+	}
+	return result
+}
+
+// LoadKingSafetyWeights reads the weights from a file and uses them in the evaluation
+func LoadKingSafetyWeights(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	weights, err := ReadKingSafetyWeights(file)
+	if err != nil {
+		return err
+	}
+	KingSafety = *weights
+	return nil
+}
+
+// ReadKingSafetyWeights reads weights in the format written by Write. A line with the name of the weights,
+// like "open file" or "danger", is followed by their values. Weights left out keep their default values.
+func ReadKingSafetyWeights(r io.Reader) (*KingSafetyWeights, error) {
+	weights := DefaultKingSafety
+	var values []*int
+	var name string
+	filled := 0
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			if filled < len(values) {
+				return nil, fmt.Errorf("king safety line %d: %s has %d values, not %d", lineNumber, name, filled, len(values))
+			}
+			name = strings.Join(fields, " ")
+			if values = weights.lookup(name); values == nil {
+				return nil, fmt.Errorf("king safety line %d: unknown weights %q", lineNumber, name)
+			}
+			filled = 0
+			continue
+		}
+
+		for _, field := range fields {
+			value, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("king safety line %d: %w", lineNumber, err)
+			}
+			if filled == len(values) {
+				return nil, fmt.Errorf("king safety line %d: value outside of the weights", lineNumber)
+			}
+			*values[filled] = value
+			filled++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if filled < len(values) {
+		return nil, fmt.Errorf("king safety: %s has %d values, not %d", name, filled, len(values))
+	}
+
+	return &weights, nil
+}
+
+// Write the weights in the format read by ReadKingSafetyWeights, as a starting point for tuning
+func (weights *KingSafetyWeights) Write(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for i, name := range kingSafetyNames {
+		if i > 0 {
+			writer.WriteString("\n")
+		}
+		fmt.Fprintf(writer, "%s\n", name)
+		for j, value := range weights.lookup(name) {
+			// Ten values to a line, which keeps the danger table readable
+			if j > 0 && j%10 == 0 {
+				writer.WriteString("\n")
+			}
+			fmt.Fprintf(writer, "%4d", *value)
+		}
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
@@ -7,7 +7,29 @@ import (
 
 type MoveList []Move
 
-const initialMoveListSize = 32
+const (
+	initialMoveListSize = 32
+
+	// No position has more legal moves than this, a list of this capacity never has to grow
+	MaxMoves = 256
+)
+
+// MoveBuffer is a fixed size list, which the move generator fills in place.
+// Unlike a growing MoveList it can stay on the stack, or be reused between calls.
+type MoveBuffer struct {
+	moves [MaxMoves]Move
+	count int
+}
+
+func (mb *MoveBuffer) add(move Move) {
+	mb.moves[mb.count] = move
+	mb.count++
+}
+
+// Moves are the moves in the buffer, they are overwritten when the buffer is filled again
+func (mb *MoveBuffer) Moves() MoveList {
+	return mb.moves[:mb.count]
+}
 
 func NewMoveList() *MoveList {
 	moveList := make(MoveList, 0, initialMoveListSize)
@@ -15,14 +37,7 @@ func NewMoveList() *MoveList {
 }
 
 func (ml *MoveList) Append(moves ...Move) {
-	l := len(*ml)
-	if l+len(moves) > cap(*ml) {
-		newList := make(MoveList, (l+len(moves))*2)
-		copy(newList, *ml)
-		*ml = newList // Update the pointer to the new list
-	}
-	*ml = (*ml)[0 : l+len(moves)]
-	copy((*ml)[l:], moves)
+	*ml = append(*ml, moves...)
 }
 
 func (ml *MoveList) Get(index int) *Move {
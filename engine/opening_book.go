@@ -4,144 +4,246 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"math/rand"
+	"math"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 )
 
-type obNode struct {
-	uciMove  string
-	children []*obNode
+// OpeningBook holds the book moves of every position, keyed by the Zobrist key of the position.
+// Lines which reach the same position share its moves, such that transpositions are found,
+// and the book can be used in games started from a FEN.
+type OpeningBook struct {
+	positions map[uint64][]BookMove
+
+	// Always play the move with the highest weight, instead of a weighted random one
+	BestMove bool
 }
 
-func newNode(move string) *obNode {
-	return &obNode{
-		uciMove:  move,
-		children: make([]*obNode, 0),
-	}
+func NewOpeningBook() *OpeningBook {
+	return &OpeningBook{positions: make(map[uint64][]BookMove)}
 }
 
-func (bn *obNode) Contains(move string) (bool, *obNode) {
-	for _, child := range bn.children {
-		if child.uciMove == move {
-			return true, child
-		}
+func LoadOpeningBook(path string) (*OpeningBook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-	return false, nil
+	defer file.Close()
+
+	return ReadOpeningBook(file)
 }
 
-func (bn *obNode) addChild(move string) *obNode {
-	if exists, node := bn.Contains(move); exists {
-		return node
+// ReadOpeningBook reads lines of moves played from the starting position, like "e2e4 e7e5 g1f3".
+// Every time a line passes through a move, the count and the weight of the move go up by one.
+// A move can also be given with its weight, like "e2e4:3", which sets the weight instead, as written by WriteLines.
+// Empty lines and lines starting with '#' are skipped.
+func ReadOpeningBook(r io.Reader) (*OpeningBook, error) {
+	book := NewOpeningBook()
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := book.AddLine(FromStandardStartingPosition(), strings.Fields(line)); err != nil {
+			return nil, fmt.Errorf("book line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
 	}
-	nn := newNode(move)
-
-	bn.children = append(bn.children, nn)
 
-	return nn
+	return book, nil
 }
 
-type OpeningBook struct {
-	Root *obNode
+// AddLine adds the moves played from the position to the book, the position is left at the end of the line
+func (book *OpeningBook) AddLine(pos *Position, moves []string) error {
+	for _, text := range moves {
+		text, weightText, weighted := strings.Cut(text, ":")
+		move, err := ParseMove(pos, text)
+		if err != nil {
+			return err
+		}
+		if weighted {
+			weight, err := strconv.Atoi(weightText)
+			if err != nil || weight < 0 {
+				return fmt.Errorf("invalid weight %q of %s", weightText, text)
+			}
+			book.setWeight(pos, move, weight)
+		} else {
+			book.Add(pos, move, 1)
+		}
+		pos.MakeMove(move)
+	}
+	return nil
 }
 
-func NewOpeningBook() *OpeningBook {
-	ob := OpeningBook{}
-	ob.Root = newNode("ROOT")
-
-	dat, err := os.Open("resources/book_openings.txt")
-	check(err)
-	reader := bufio.NewReader(dat)
-
-	reader.ReadString('\n')
-	for {
-		line, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
+// Add raises the weight of the move in the position, and counts it once more
+func (book *OpeningBook) Add(pos *Position, move Move, weight int) {
+	key := bookKey(pos)
+	moves := book.positions[key]
+	for i := range moves {
+		if moves[i].Move == move {
+			moves[i].Weight += weight
+			moves[i].Count++
+			return
 		}
-		check(err)
+	}
+	book.positions[key] = append(moves, BookMove{Move: move, Weight: weight, Count: 1})
+}
 
-		moves := strings.Split(line, " ")
-		curr := ob.Root
-		for _, move := range moves {
-			nn := curr.addChild(move)
-			curr = nn
+// setWeight sets the weight of the move in the position, a move new to the book is counted once
+func (book *OpeningBook) setWeight(pos *Position, move Move, weight int) {
+	key := bookKey(pos)
+	moves := book.positions[key]
+	for i := range moves {
+		if moves[i].Move == move {
+			moves[i].Weight = weight
+			return
 		}
 	}
-
-	return &ob
+	book.positions[key] = append(moves, BookMove{Move: move, Weight: weight, Count: 1})
 }
 
-// Can be used to get a move from the opening book, only call if InBook returns true
-func (ob *OpeningBook) GetBookMove(pos *Position) Move {
-	curr := ob.Root
-	moves := pos.MoveHistory
-	for _, move := range *moves {
-		if exists, node := curr.Contains(move.UCIString()); exists {
-			curr = node
-		} else {
-			break
-		}
+// Moves in the book for the position, the moves which are not legal in the position are left out
+func (book *OpeningBook) Moves(pos *Position) []BookMove {
+	entries := book.positions[bookKey(pos)]
+	if len(entries) == 0 {
+		return nil
 	}
 
-	for i, child := range curr.children {
-		fmt.Printf("%d: %s\n", i, child.uciMove)
+	// A different position with the same key would give moves which are not legal here
+	legalMoves := LegalMoves(pos)
+	moves := make([]BookMove, 0, len(entries))
+	for _, entry := range entries {
+		if slices.Contains(legalMoves, entry.Move) {
+			moves = append(moves, entry)
+		}
 	}
+	return moves
+}
 
-	mIdx := rand.Int() % (len(curr.children))
-	m, err := ParseUCIMove(pos, curr.children[mIdx].uciMove)
-	if err != nil {
-		fmt.Printf("%+v  %+v \n", mIdx, len(curr.children))
-		panic("invalid move, tried to parse: " + curr.children[mIdx].uciMove)
+// Move picks a book move for the position, false if the position is not in the book
+func (book *OpeningBook) Move(pos *Position) (Move, bool) {
+	return pickBookMove(book.Moves(pos), book.BestMove)
+}
+
+// Positions is the number of positions in the book
+func (book *OpeningBook) Positions() int {
+	return len(book.positions)
+}
+
+// bookKey is the Zobrist key of the position, but with the en passant file only when a capture is possible.
+// The key of the position otherwise depends on whether the last move was a double push, as in 1.Nf3 d5 2.d4.
+func bookKey(pos *Position) uint64 {
+	if pos.EPFile != 0 && !pos.canCaptureEnPassant() {
+		return pos.Hash ^ zobristEPFile[pos.EPFile]
 	}
+	return pos.Hash
+}
 
-	return m
+// canCaptureEnPassant is true when a pawn of the side to move attacks the en passant square
+func (pos *Position) canCaptureEnPassant() bool {
+	if pos.EPFile == 0 {
+		return false
+	}
+	epSquare := DeriveSquare(int(pos.EPFile), 6)
+	if pos.ColorToMove == Black {
+		epSquare = DeriveSquare(int(pos.EPFile), 3)
+	}
+	them := pos.ColorToMove.opposite()
+	return pawnAttacks[them][epSquare]&pos.pieceBitboards[pos.ColorToMove][Pawn] != 0
 }
 
-func (ob *OpeningBook) InBook(moves *MoveList) bool {
-	curr := ob.Root
-	for _, move := range *moves {
-		if exists, node := curr.Contains(move.UCIString()); exists {
-			curr = node
+// Prune removes the moves played fewer than minCount times
+func (book *OpeningBook) Prune(minCount int) {
+	for key, moves := range book.positions {
+		moves = slices.DeleteFunc(moves, func(move BookMove) bool {
+			return move.Count < minCount
+		})
+		if len(moves) == 0 {
+			delete(book.positions, key)
 		} else {
-			return false
+			book.positions[key] = moves
 		}
 	}
-	return !(len(curr.children) == 0)
-}
-
-func (ob *OpeningBook) String() string {
-	return ob.Root.String()
 }
 
-func (bn *obNode) ChildrenString() string {
-	var builder strings.Builder
-	for _, child := range bn.children {
-		builder.WriteString(child.uciMove)
-		builder.WriteString(" ")
+// walk calls visit for every position reached by book moves from the starting position.
+// Positions out of book, and positions reached before by a transposition, are visited without moves.
+// The moves played to reach the position are passed along, visit must not keep them.
+func (book *OpeningBook) walk(visit func(pos *Position, line []BookMove, moves []BookMove)) {
+	visited := make(map[uint64]bool)
+	var line []BookMove
+
+	var walkFrom func(pos *Position)
+	walkFrom = func(pos *Position) {
+		key := bookKey(pos)
+		if visited[key] {
+			visit(pos, line, nil)
+			return
+		}
+		visited[key] = true
 
+		moves := book.Moves(pos)
+		visit(pos, line, moves)
+		for _, move := range moves {
+			line = append(line, move)
+			pos.MakeMove(move.Move)
+			walkFrom(pos)
+			pos.UndoMove(move.Move)
+			line = line[:len(line)-1]
+		}
 	}
-	return builder.String()
+	walkFrom(FromStandardStartingPosition())
 }
 
-var indent int = 0
+// WriteLines writes the book in the format read by ReadOpeningBook, a line for every way out of the book.
+// Every move is written with its weight, such that reading the lines back gives the same weights.
+func (book *OpeningBook) WriteLines(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	book.walk(func(pos *Position, line []BookMove, moves []BookMove) {
+		if len(moves) > 0 || len(line) == 0 {
+			return
+		}
+		for i, move := range line {
+			if i > 0 {
+				writer.WriteString(" ")
+			}
+			fmt.Fprintf(writer, "%s:%d", move.Move.UCIString(), move.Weight)
+		}
+		writer.WriteString("\n")
+	})
+	return writer.Flush()
+}
 
-func (bn *obNode) String() string {
-	var builder strings.Builder
+// PolyglotEntries are the moves of the book as Polyglot book entries.
+// Weights are scaled down when they don't fit the 16 bits of the format.
+func (book *OpeningBook) PolyglotEntries() ([]PolyglotEntry, error) {
+	if !polyglotKeysAvailable() {
+		return nil, ErrPolyglotKeysMissing
+	}
 
-	builder.WriteString(bn.uciMove)
-	indent += 1
-	builder.WriteString(fmt.Sprint(" "))
-	if len(bn.children) == 1 {
-		builder.WriteString(bn.children[0].String())
-	} else {
-		for i, child := range bn.children {
-			builder.WriteString("\n")
-			builder.WriteString(strings.Repeat(" ", indent*5))
-			builder.WriteString(fmt.Sprintf("%d. ", i+1))
-			builder.WriteString(child.String())
+	maxWeight := 0
+	for _, moves := range book.positions {
+		for _, move := range moves {
+			maxWeight = max(maxWeight, move.Weight)
 		}
 	}
-	indent -= 1
-	return builder.String()
+
+	var entries []PolyglotEntry
+	book.walk(func(pos *Position, line []BookMove, moves []BookMove) {
+		key := PolyglotKey(pos)
+		for _, move := range moves {
+			weight := move.Weight
+			if maxWeight > math.MaxUint16 {
+				weight = weight * math.MaxUint16 / maxWeight
+			}
+			entries = append(entries, PolyglotEntry{Key: key, Move: EncodePolyglotMove(move.Move), Weight: uint16(weight)})
+		}
+	})
+	return entries, nil
 }
@@ -0,0 +1,217 @@
+package engine
+
+// Pawn structure evaluation. The pawns change in few moves, so their evaluation is cached in a pawn hash table.
+
+// Pawn structure weights, in the middlegame and in the endgame. Ranks are counted from the pawn's own side.
+var (
+	doubledPawn  = [2]int{-10, -20}
+	isolatedPawn = [2]int{-10, -15}
+	backwardPawn = [2]int{-8, -10}
+
+	// Bonus of a pawn defended by a pawn, or standing next to one, by rank
+	connectedPawn = [2][9]int{
+		{0, 0, 5, 7, 10, 15, 25, 40, 0},
+		{0, 0, 3, 5, 8, 12, 20, 30, 0},
+	}
+
+	// Bonus of a pawn without enemy pawns in front of it or on the files next to it, by rank
+	passedPawn = [2][9]int{
+		{0, 0, 5, 10, 15, 25, 40, 60, 0},
+		{0, 0, 10, 20, 35, 55, 85, 120, 0},
+	}
+
+	// Endgame bonus of a passed pawn which has no piece in front of it, by rank
+	freePassedPawn = [9]int{0, 0, 2, 5, 10, 20, 35, 60, 0}
+
+	// Endgame bonus for each square the enemy king is further away from the square in front of a passed pawn
+	// than the own king, multiplied by the rank
+	passedKingDistance = 2
+)
+
+var (
+	// Squares in front of a pawn on the file, seen from the pawn's side
+	forwardFileBB [2][65]Bitboard
+	// Squares in front of a pawn on its file and the files next to it, enemy pawns there stop a passed pawn
+	passedPawnMaskBB [2][65]Bitboard
+	// Squares on the files next to the square, from its rank back to the pawn's own side
+	supportMaskBB [2][65]Bitboard
+	// The files next to the square
+	adjacentFilesBB [65]Bitboard
+)
+
+func init() {
+	for sq := Square(1); sq <= 64; sq++ {
+		file := fileBB(sq)
+		adjacent := (file&^FileHBB)<<1 | (file&^FileABB)>>1
+		adjacentFilesBB[sq] = adjacent
+
+		for rank := int8(1); rank <= 8; rank++ {
+			rankBits := Rank1BB << (8 * (rank - 1))
+			if rank > Rank(sq) {
+				forwardFileBB[White][sq] |= file & rankBits
+				passedPawnMaskBB[White][sq] |= (file | adjacent) & rankBits
+			} else {
+				supportMaskBB[White][sq] |= adjacent & rankBits
+			}
+			if rank < Rank(sq) {
+				forwardFileBB[Black][sq] |= file & rankBits
+				passedPawnMaskBB[Black][sq] |= (file | adjacent) & rankBits
+			} else {
+				supportMaskBB[Black][sq] |= adjacent & rankBits
+			}
+		}
+	}
+}
+
+// relativeRank counts the ranks from the side of the color, such that pawns start on rank 2
+func relativeRank(color Color, sq Square) int {
+	if color == White {
+		return int(Rank(sq))
+	}
+	return 9 - int(Rank(sq))
+}
+
+// The square in front of a pawn
+func pawnStopSquare(color Color, sq Square) Square {
+	if color == White {
+		return sq + 8
+	}
+	return sq - 8
+}
+
+func distance(a, b Square) int {
+	return max(abs(int(File(a))-int(File(b))), abs(int(Rank(a))-int(Rank(b))))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// pawnEntry is the evaluation of a pawn structure, from White's side
+type pawnEntry struct {
+	key        uint64
+	middlegame int32
+	endgame    int32
+	passed     Bitboard // Passed pawns of both colors, they are evaluated further with the pieces on the board
+}
+
+// PawnTable caches the evaluation of pawn structures, keyed by the pawn key of the position.
+// It is not safe for concurrent use, every search thread has its own.
+type PawnTable struct {
+	entries []pawnEntry
+	mask    uint64
+}
+
+const DefaultPawnTableEntries = 1 << 14
+
+// NewPawnTable makes a table of the number of entries, which is rounded down to a power of two
+func NewPawnTable(entries int) *PawnTable {
+	size := 1
+	for size*2 <= entries {
+		size *= 2
+	}
+	return &PawnTable{entries: make([]pawnEntry, size), mask: uint64(size - 1)}
+}
+
+// probe returns the evaluation of the pawn structure, it is computed and stored when it is not in the table
+func (table *PawnTable) probe(pos *Position) *pawnEntry {
+	entry := &table.entries[pos.PawnHash&table.mask]
+	// An empty entry has key 0, which is the key without pawns, and scores nothing as it should
+	if entry.key != pos.PawnHash {
+		*entry = evaluatePawnStructure(pos)
+		entry.key = pos.PawnHash
+	}
+	return entry
+}
+
+// evaluatePawnStructure scores the pawns on their own, without the other pieces
+func evaluatePawnStructure(pos *Position) pawnEntry {
+	var entry pawnEntry
+	var scores [2]int
+
+	for color := White; color <= Black; color++ {
+		them := color.opposite()
+		ours := pos.pieceBitboards[color][Pawn]
+		theirs := pos.pieceBitboards[them][Pawn]
+		theirAttacks := pawnSetAttacks(them, theirs)
+		sign := who2move(color)
+
+		pawns := ours
+		for pawns != 0 {
+			sq := pawns.Pop()
+			rank := relativeRank(color, sq)
+			stop := pawnStopSquare(color, sq)
+
+			supported := pawnAttacks[them][sq]&ours != 0
+			phalanx := adjacentFilesBB[sq]&rankBB(sq)&ours != 0
+
+			for phase := range scores {
+				score := 0
+				if forwardFileBB[color][sq]&ours != 0 {
+					score += doubledPawn[phase]
+				}
+				if adjacentFilesBB[sq]&ours == 0 {
+					score += isolatedPawn[phase]
+				} else if supportMaskBB[color][sq]&ours == 0 && theirAttacks.IsSet(stop) {
+					// No pawn can come up to defend it, and it can't advance safely
+					score += backwardPawn[phase]
+				}
+				if supported || phalanx {
+					score += connectedPawn[phase][rank]
+				}
+				scores[phase] += sign * score
+			}
+
+			// A pawn behind another pawn of its own is not counted as passed, the front one is
+			if passedPawnMaskBB[color][sq]&theirs == 0 && forwardFileBB[color][sq]&ours == 0 {
+				entry.passed.Set(sq)
+				scores[0] += sign * passedPawn[0][rank]
+				scores[1] += sign * passedPawn[1][rank]
+			}
+		}
+	}
+
+	entry.middlegame, entry.endgame = int32(scores[0]), int32(scores[1])
+	return entry
+}
+
+// pawnScore is the pawn structure score from White's side, the pawn table may be nil
+func pawnScore(pos *Position, table *PawnTable, phase int) int {
+	var entry pawnEntry
+	if table != nil {
+		entry = *table.probe(pos)
+	} else {
+		entry = evaluatePawnStructure(pos)
+	}
+
+	middlegame, endgame := int(entry.middlegame), int(entry.endgame)
+	endgame += passedPawnEndgame(pos, entry.passed)
+
+	return taper(middlegame, endgame, phase)
+}
+
+// passedPawnEndgame scores the passed pawns with the pieces around them, it can't be cached in the pawn table
+func passedPawnEndgame(pos *Position, passed Bitboard) int {
+	occupied := pos.AllPieces()
+	score := 0
+	for passed != 0 {
+		sq := passed.Pop()
+		color := pos.Board[sq].Color
+		rank := relativeRank(color, sq)
+		stop := pawnStopSquare(color, sq)
+
+		bonus := 0
+		if forwardFileBB[color][sq]&occupied == 0 {
+			bonus += freePassedPawn[rank]
+		}
+		// The own king escorts the pawn, the enemy king has to catch it
+		kingDistance := distance(pos.GetKingSquare(color.opposite()), stop) - distance(pos.GetKingSquare(color), stop)
+		bonus += kingDistance * passedKingDistance * max(rank-2, 0)
+
+		score += who2move(color) * bonus
+	}
+	return score
+}
@@ -41,7 +41,8 @@ func Perft(pos *Position, depth int) int {
 	}
 	nodes := 0
 
-	moveList := LegalMoves(pos)
+	var buffer MoveBuffer
+	moveList := GenerateLegalMoves(pos, &buffer)
 
 	if depth == 1 {
 		return len(moveList)
@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+)
+
+// Polyglot opening books, a sorted list of 16 byte entries keyed by the Polyglot Zobrist key of the position.
+// Reference: http://hgm.nubati.net/book_format.html
+
+var ErrPolyglotKeysMissing = errors.New("polyglot: the Random64 key table is missing")
+
+// Offsets into the Random64 array
+const (
+	polyglotCastlingOffset = 768
+	polyglotEPOffset       = 772
+	polyglotTurnOffset     = 780
+)
+
+type PolyglotEntry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// BookMove is a move found in a book, moves with a higher weight are played more often
+type BookMove struct {
+	Move   Move
+	Weight int
+	Count  int // Times the move was played in the games the book was built from
+}
+
+// Book is a source of opening moves
+type Book interface {
+	// Move picks a book move for the position, false if the position is not in the book
+	Move(pos *Position) (Move, bool)
+}
+
+type PolyglotBook struct {
+	entries []PolyglotEntry
+
+	// Always play the move with the highest weight, instead of a weighted random one
+	BestMove bool
+}
+
+func LoadPolyglotBook(path string) (*PolyglotBook, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadPolyglotBook(file)
+}
+
+func ReadPolyglotBook(r io.Reader) (*PolyglotBook, error) {
+	if !polyglotKeysAvailable() {
+		return nil, ErrPolyglotKeysMissing
+	}
+
+	book := &PolyglotBook{}
+	reader := bufio.NewReader(r)
+	for {
+		var entry PolyglotEntry
+		err := binary.Read(reader, binary.BigEndian, &entry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		book.entries = append(book.entries, entry)
+	}
+
+	// Books should be sorted already, but a binary search on an unsorted book would miss moves
+	slices.SortStableFunc(book.entries, func(a, b PolyglotEntry) int {
+		return compareKeys(a.Key, b.Key)
+	})
+
+	return book, nil
+}
+
+// WritePolyglotBook writes the entries sorted by key, as the format requires
+func WritePolyglotBook(w io.Writer, entries []PolyglotEntry) error {
+	sorted := slices.Clone(entries)
+	slices.SortStableFunc(sorted, func(a, b PolyglotEntry) int {
+		return compareKeys(a.Key, b.Key)
+	})
+
+	writer := bufio.NewWriter(w)
+	for _, entry := range sorted {
+		if err := binary.Write(writer, binary.BigEndian, entry); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func compareKeys(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Moves in the book for the position, the moves which are not legal in the position are left out
+func (book *PolyglotBook) Moves(pos *Position) []BookMove {
+	key := PolyglotKey(pos)
+	i, _ := slices.BinarySearchFunc(book.entries, key, func(entry PolyglotEntry, key uint64) int {
+		return compareKeys(entry.Key, key)
+	})
+
+	var moves []BookMove
+	for ; i < len(book.entries) && book.entries[i].Key == key; i++ {
+		if move, ok := DecodePolyglotMove(pos, book.entries[i].Move); ok {
+			moves = append(moves, BookMove{Move: move, Weight: int(book.entries[i].Weight)})
+		}
+	}
+	return moves
+}
+
+func (book *PolyglotBook) Move(pos *Position) (Move, bool) {
+	return pickBookMove(book.Moves(pos), book.BestMove)
+}
+
+// pickBookMove picks the move with the highest weight, or a random move with a chance proportional to its weight
+func pickBookMove(moves []BookMove, best bool) (Move, bool) {
+	if len(moves) == 0 {
+		return NilMove(), false
+	}
+
+	if best {
+		bestMove := moves[0]
+		for _, move := range moves[1:] {
+			if move.Weight > bestMove.Weight {
+				bestMove = move
+			}
+		}
+		return bestMove.Move, true
+	}
+
+	total := 0
+	for _, move := range moves {
+		total += move.Weight
+	}
+	if total == 0 {
+		// Without weights every move is as good
+		return moves[rand.Intn(len(moves))].Move, true
+	}
+
+	pick := rand.Intn(total)
+	for _, move := range moves {
+		if pick < move.Weight {
+			return move.Move, true
+		}
+		pick -= move.Weight
+	}
+	return moves[len(moves)-1].Move, true
+}
+
+// PolyglotKey is the Zobrist key of the position, as used by Polyglot books
+func PolyglotKey(pos *Position) uint64 {
+	var key uint64
+
+	for sq := Square(1); sq <= 64; sq++ {
+		piece := pos.Board[sq]
+		if piece.PType == NoPiece {
+			continue
+		}
+		// Black pawn is 0, white pawn 1, black knight 2 and so on
+		kind := 2*int(piece.PType) + 1 - int(piece.Color)
+		key ^= polyglotRandom[64*kind+int(sq-1)]
+	}
+
+	wk, wq, bk, bq := pos.getCastlingRights()
+	for i, right := range []bool{wk, wq, bk, bq} {
+		if right {
+			key ^= polyglotRandom[polyglotCastlingOffset+i]
+		}
+	}
+
+	// The en passant file only counts when a pawn can actually capture
+	if pos.canCaptureEnPassant() {
+		key ^= polyglotRandom[polyglotEPOffset+int(pos.EPFile)-1]
+	}
+
+	if pos.ColorToMove == White {
+		key ^= polyglotRandom[polyglotTurnOffset]
+	}
+
+	return key
+}
+
+// Promotion pieces in the order of the format, 0 is no promotion
+var polyglotPromotions = [5]MoveFlag{NoFlag, PromotionToKnight, PromotionToBishop, PromotionToRook, PromotionToQueen}
+
+// EncodePolyglotMove packs the move as in the book format, castling is written as the king capturing its rook
+func EncodePolyglotMove(move Move) uint16 {
+	to := move.To
+	if move.Flag == Castling {
+		if File(move.To) == 7 {
+			to = move.To + 1
+		} else {
+			to = move.To - 2
+		}
+	}
+
+	promotion := slices.Index(polyglotPromotions[:], move.Flag)
+	if promotion < 0 {
+		promotion = 0
+	}
+
+	return uint16(File(to)-1) | uint16(Rank(to)-1)<<3 |
+		uint16(File(move.From)-1)<<6 | uint16(Rank(move.From)-1)<<9 |
+		uint16(promotion)<<12
+}
+
+// DecodePolyglotMove finds the legal move of the packed book move, false if it is not legal
+func DecodePolyglotMove(pos *Position, packed uint16) (Move, bool) {
+	to := DeriveSquare(int(packed&7)+1, int(packed>>3&7)+1)
+	from := DeriveSquare(int(packed>>6&7)+1, int(packed>>9&7)+1)
+	promotion := int(packed >> 12 & 7)
+	if promotion >= len(polyglotPromotions) {
+		return NilMove(), false
+	}
+
+	for _, move := range LegalMoves(pos) {
+		if move.From != from {
+			continue
+		}
+		// Castling is accepted as the king capturing its rook, and as the king's own move
+		if move.Flag == Castling && (EncodePolyglotMove(move) == packed || move.To == to) {
+			return move, true
+		}
+		if move.Flag != Castling && move.To == to && (!move.Flag.IsPromotion() || move.Flag == polyglotPromotions[promotion]) {
+			return move, true
+		}
+	}
+	return NilMove(), false
+}
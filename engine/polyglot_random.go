@@ -0,0 +1,18 @@
+package engine
+
+// polyglotRandom is the Random64 array of the Polyglot book format. Keys of books made by other programs
+// only match when it holds exactly the 781 values given in the specification:
+// http://hgm.nubati.net/book_format.html
+//
+// The values are not part of this tree yet, they have to be copied in from the specification.
+// Until then the table is empty, and Polyglot books are refused with ErrPolyglotKeysMissing.
+var polyglotRandom [781]uint64
+
+func polyglotKeysAvailable() bool {
+	for _, key := range polyglotRandom {
+		if key != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 )
 
@@ -23,8 +24,14 @@ type State struct {
 	CastlingRights uint8
 	Moved          Piece
 	Captured       Piece
-	Rule50         int8
-	Ply            uint16
+	Rule50         int16
+	Move           Move
+	Hash           uint64 // Zobrist key before the move, used for repetition detection
+
+	// Pawn key and evaluation sums before the move
+	PawnHash   uint64
+	Middlegame int
+	Endgame    int
 }
 
 type Position struct {
@@ -34,21 +41,27 @@ type Position struct {
 	ColorToMove    Color
 	CastlingRights uint8
 	EPFile         int8
-	Rule50         int8
-	Ply            uint16
+	Rule50         int16
+	Ply            uint16 // Fullmove number as in FEN, it starts at the FEN's counter and is incremented after Black's move
 
-	// History
-	prevStates  [100]State
+	// Zobrist key, updated incrementally by MakeMove and UndoMove
+	Hash uint64
+
+	// Zobrist key of the pawns alone, it is the key of the pawn hash table
+	PawnHash uint64
+
+	// Material and piece-square sums from White's side, updated incrementally like the hash
+	middlegame int
+	endgame    int
+
+	// History, one state for every move made since the position was set up
+	prevStates  []State
 	MoveHistory *MoveList
 
 	// King positions
 	WhiteKing Square
 	BlackKing Square
 
-	// finished state
-	Checkmate bool
-	Stalemate bool
-
 	// Piece Bitboards
 	// in White pieces (P, N, B, R, Q, K)
 	// 6-11 Black pieces (P, N, B, R, Q, K)
@@ -63,11 +76,23 @@ func NewPosition() *Position {
 	pos := &Position{
 		ColorToMove: White,
 		Board:       [65]Piece{},
+		prevStates:  make([]State, 0, MaxPly),
 		MoveHistory: NewMoveList(),
 	}
 	return pos
 }
 
+// Copy returns a deep copy of the position, which shares no history with the original
+func (pos *Position) Copy() *Position {
+	cpy := *pos
+	history := make(MoveList, len(*pos.MoveHistory), max(cap(*pos.MoveHistory), initialMoveListSize))
+	copy(history, *pos.MoveHistory)
+	cpy.MoveHistory = &history
+	// Room for a search to its maximum depth, without growing the history
+	cpy.prevStates = slices.Grow(slices.Clone(pos.prevStates), MaxPly)
+	return &cpy
+}
+
 func (pos *Position) PieceBitboard(p Piece) *Bitboard {
 	return &pos.pieceBitboards[p.Color][p.PType]
 }
@@ -142,9 +167,16 @@ func (pos *Position) MakeMove(move Move) {
 		Moved:          movedPiece,
 		Captured:       capturedPiece,
 		Rule50:         pos.Rule50,
-		Ply:            pos.Ply,
+		Move:           move,
+		Hash:           pos.Hash,
+		PawnHash:       pos.PawnHash,
+		Middlegame:     pos.middlegame,
+		Endgame:        pos.endgame,
 	}
 
+	// The castling rights and en passant file are hashed back in, once they are updated
+	pos.Hash ^= zobristCastling[pos.CastlingRights] ^ zobristEPFile[pos.EPFile]
+
 	// Move the piece
 	pos.Board[move.To] = movedPiece
 	pos.Board[move.From] = Piece{NoColor, NoPiece}
@@ -159,6 +191,11 @@ func (pos *Position) MakeMove(move Move) {
 		*pos.PieceBitboard(capturedPiece) ^= toBB
 	}
 
+	pos.Hash ^= zobristPiece(movedPiece, move.From) ^ zobristPiece(movedPiece, move.To) ^ zobristPiece(capturedPiece, move.To)
+	pos.pieceRemoved(movedPiece, move.From)
+	pos.pieceAdded(movedPiece, move.To)
+	pos.pieceRemoved(capturedPiece, move.To)
+
 	// Update the EPFile
 
 	pos.EPFile = 0
@@ -193,34 +230,54 @@ func (pos *Position) MakeMove(move Move) {
 		if movedPiece.Color == White {
 			pos.Board[move.To-8] = Piece{NoColor, NoPiece}
 			*pos.PieceBitboard(Piece{Black, Pawn}) ^= BBFromSquares(move.To - 8)
+			pos.Hash ^= zobristPiece(Piece{Black, Pawn}, move.To-8)
+			pos.pieceRemoved(Piece{Black, Pawn}, move.To-8)
 			state.Captured = Piece{PType: Pawn, Color: Black}
 		} else {
 			pos.Board[move.To+8] = Piece{NoColor, NoPiece}
 			*pos.PieceBitboard(Piece{White, Pawn}) ^= BBFromSquares(move.To + 8)
+			pos.Hash ^= zobristPiece(Piece{White, Pawn}, move.To+8)
+			pos.pieceRemoved(Piece{White, Pawn}, move.To+8)
 			state.Captured = Piece{PType: Pawn, Color: White}
 		}
 	case PromotionToQueen:
 		pos.Board[move.To] = Piece{Color: movedPiece.Color, PType: Queen}
 		*pos.PieceBitboard(Piece{movedPiece.Color, Queen}) ^= toBB
 		*pos.PieceBitboard(movedPiece) ^= toBB
+		pos.Hash ^= zobristPiece(movedPiece, move.To) ^ zobristPiece(pos.Board[move.To], move.To)
+		pos.pieceRemoved(movedPiece, move.To)
+		pos.pieceAdded(pos.Board[move.To], move.To)
 	case PromotionToKnight:
 		pos.Board[move.To] = Piece{Color: movedPiece.Color, PType: Knight}
 		*pos.PieceBitboard(Piece{movedPiece.Color, Knight}) ^= toBB
 		*pos.PieceBitboard(movedPiece) ^= toBB
+		pos.Hash ^= zobristPiece(movedPiece, move.To) ^ zobristPiece(pos.Board[move.To], move.To)
+		pos.pieceRemoved(movedPiece, move.To)
+		pos.pieceAdded(pos.Board[move.To], move.To)
 	case PromotionToRook:
 		pos.Board[move.To] = Piece{Color: movedPiece.Color, PType: Rook}
 		*pos.PieceBitboard(Piece{movedPiece.Color, Rook}) ^= toBB
 		*pos.PieceBitboard(movedPiece) ^= toBB
+		pos.Hash ^= zobristPiece(movedPiece, move.To) ^ zobristPiece(pos.Board[move.To], move.To)
+		pos.pieceRemoved(movedPiece, move.To)
+		pos.pieceAdded(pos.Board[move.To], move.To)
 	case PromotionToBishop:
 		pos.Board[move.To] = Piece{Color: movedPiece.Color, PType: Bishop}
 		*pos.PieceBitboard(Piece{movedPiece.Color, Bishop}) ^= toBB
 		*pos.PieceBitboard(movedPiece) ^= toBB
+		pos.Hash ^= zobristPiece(movedPiece, move.To) ^ zobristPiece(pos.Board[move.To], move.To)
+		pos.pieceRemoved(movedPiece, move.To)
+		pos.pieceAdded(pos.Board[move.To], move.To)
 	}
 
 	pos.updateCastlingRights()
 
-	pos.prevStates[pos.Ply] = state
-	pos.Ply++
+	pos.Hash ^= zobristCastling[pos.CastlingRights] ^ zobristEPFile[pos.EPFile] ^ zobristBlackToMove
+
+	pos.prevStates = append(pos.prevStates, state)
+	if pos.ColorToMove == Black {
+		pos.Ply++
+	}
 
 	if movedPiece.PType == King {
 		if movedPiece.Color == White {
@@ -231,6 +288,11 @@ func (pos *Position) MakeMove(move Move) {
 	}
 
 	pos.ColorToMove = pos.ColorToMove.opposite()
+
+	if DebugMode {
+		pos.checkHash()
+		pos.checkScores()
+	}
 }
 
 func (pos *Position) updateCastlingRights() {
@@ -278,12 +340,25 @@ func (pos *Position) UndoMove(move Move) {
 		panic("Move history does not match")
 	}
 
-	pos.Ply--
-	prevState := pos.prevStates[pos.Ply]
+	prevState := pos.prevStates[len(pos.prevStates)-1]
+	pos.prevStates = pos.prevStates[:len(pos.prevStates)-1]
+	if prevState.Moved.Color == Black {
+		pos.Ply--
+	}
+
+	pos.Hash ^= zobristBlackToMove
+	pos.Hash ^= zobristCastling[pos.CastlingRights] ^ zobristCastling[prevState.CastlingRights]
+	pos.Hash ^= zobristEPFile[pos.EPFile] ^ zobristEPFile[prevState.EPFile]
+
+	// The piece on the to square is the moved piece, or what it was promoted to
+	pos.Hash ^= zobristPiece(pos.Board[move.To], move.To) ^ zobristPiece(prevState.Moved, move.From)
 
 	pos.EPFile = prevState.EPFile
 	pos.Rule50 = prevState.Rule50
 	pos.CastlingRights = prevState.CastlingRights
+	pos.PawnHash = prevState.PawnHash
+	pos.middlegame = prevState.Middlegame
+	pos.endgame = prevState.Endgame
 
 	pos.Board[move.From] = prevState.Moved
 
@@ -294,34 +369,37 @@ func (pos *Position) UndoMove(move Move) {
 
 	*pos.PieceBitboard(prevState.Moved) ^= fromToBB
 
+	// The promoted piece turns back into a pawn
+	if move.Flag.IsPromotion() {
+		*pos.PieceBitboard(pos.Board[move.To]) ^= toBB
+		*pos.PieceBitboard(prevState.Moved) ^= toBB
+	}
+
 	switch move.Flag {
 	default:
 		pos.Board[move.To] = prevState.Captured
 		if prevState.Captured.PType != NoPiece {
 			*pos.PieceBitboard(prevState.Captured) ^= toBB
+			pos.Hash ^= zobristPiece(prevState.Captured, move.To)
 		}
 	case Castling:
 		if prevState.Moved.Color == White {
 			if move.To == Square(3) {
 				pos.swapSquares(Square(1), Square(4))
 				pos.Board[3] = ANoPiece()
-				*pos.PieceBitboard(Piece{White, King}) ^= BBFromSquares(3, 4)
 			}
 			if move.To == Square(7) {
 				pos.swapSquares(Square(8), Square(6))
 				pos.Board[7] = ANoPiece()
-				*pos.PieceBitboard(Piece{White, King}) ^= BBFromSquares(5, 6)
 			}
 		} else {
 			if move.To == Square(59) {
 				pos.swapSquares(Square(57), Square(60))
 				pos.Board[59] = ANoPiece()
-				*pos.PieceBitboard(Piece{Black, King}) ^= BBFromSquares(59, 60)
 			}
 			if move.To == Square(63) {
 				pos.swapSquares(Square(64), Square(62))
 				pos.Board[63] = ANoPiece()
-				*pos.PieceBitboard(Piece{Black, King}) ^= BBFromSquares(61, 62)
 			}
 		}
 	case EnPassentCapture:
@@ -329,9 +407,11 @@ func (pos *Position) UndoMove(move Move) {
 		if prevState.Moved.Color == White {
 			pos.Board[move.To-8] = Piece{Black, Pawn}
 			*pos.PieceBitboard(Piece{Black, Pawn}) ^= BBFromSquares(move.To - 8)
+			pos.Hash ^= zobristPiece(Piece{Black, Pawn}, move.To-8)
 		} else {
 			pos.Board[move.To+8] = Piece{White, Pawn}
 			*pos.PieceBitboard(Piece{White, Pawn}) ^= BBFromSquares(move.To + 8)
+			pos.Hash ^= zobristPiece(Piece{White, Pawn}, move.To+8)
 		}
 	}
 
@@ -344,6 +424,11 @@ func (pos *Position) UndoMove(move Move) {
 	}
 
 	pos.ColorToMove = pos.ColorToMove.opposite()
+
+	if DebugMode {
+		pos.checkHash()
+		pos.checkScores()
+	}
 }
 
 // order : wk, wq, bk, bq
@@ -365,10 +450,30 @@ func (pos *Position) FlipColor() {
 	pos.ColorToMove = pos.ColorToMove.opposite()
 }
 
+// pieceAdded updates the pawn key and the evaluation sums for a piece put on the square
+func (pos *Position) pieceAdded(piece Piece, sq Square) {
+	middlegame, endgame := pieceScores(piece, sq)
+	pos.middlegame += middlegame
+	pos.endgame += endgame
+	if piece.PType == Pawn {
+		pos.PawnHash ^= zobristPiece(piece, sq)
+	}
+}
+
+// pieceRemoved updates the pawn key and the evaluation sums for a piece taken off the square
+func (pos *Position) pieceRemoved(piece Piece, sq Square) {
+	middlegame, endgame := pieceScores(piece, sq)
+	pos.middlegame -= middlegame
+	pos.endgame -= endgame
+	if piece.PType == Pawn {
+		pos.PawnHash ^= zobristPiece(piece, sq)
+	}
+}
+
 func (pos *Position) swapSquares(a, b Square) {
 	pos.Board[a], pos.Board[b] = pos.Board[b], pos.Board[a]
 
-	// Update bitboards, disgusting
+	// Update bitboards, disgusting. The pawn key and scores are only needed in MakeMove, UndoMove restores them.
 	aBB := BBFromSquares(a)
 	bBB := BBFromSquares(b)
 	abBB := aBB | bBB
@@ -376,8 +481,14 @@ func (pos *Position) swapSquares(a, b Square) {
 	bPiece := pos.Board[b]
 	if aPiece.PType != NoPiece {
 		*pos.PieceBitboard(aPiece) ^= abBB
+		pos.Hash ^= zobristPiece(aPiece, a) ^ zobristPiece(aPiece, b)
+		pos.pieceRemoved(aPiece, b)
+		pos.pieceAdded(aPiece, a)
 	}
 	if bPiece.PType != NoPiece {
 		*pos.PieceBitboard(bPiece) ^= abBB
+		pos.Hash ^= zobristPiece(bPiece, a) ^ zobristPiece(bPiece, b)
+		pos.pieceRemoved(bPiece, a)
+		pos.pieceAdded(bPiece, b)
 	}
 }
@@ -0,0 +1,308 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Piece-square tables, a bonus for each piece on each square, in the middlegame and in the endgame.
+// The evaluation blends the two by the game phase, such that kings hide in the middlegame and walk up in the endgame.
+
+// Phase weight of each piece type, the starting position has the full phase of 24
+var phaseWeights = [6]int{Pawn: 0, Knight: 1, Bishop: 1, Rook: 2, Queen: 4, King: 0}
+
+const MaxPhase = 24
+
+// PieceSquareTables are written from White's side, as the board is printed: a8 first and h1 last
+type PieceSquareTables struct {
+	Middlegame [6][64]int
+	Endgame    [6][64]int
+}
+
+var DefaultPieceSquareTables = PieceSquareTables{
+	Middlegame: [6][64]int{
+		Pawn: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			10, 10, 20, 30, 30, 20, 10, 10,
+			5, 5, 10, 25, 25, 10, 5, 5,
+			0, 0, 0, 20, 20, 0, 0, 0,
+			5, -5, -10, 0, 0, -10, -5, 5,
+			5, 10, 10, -20, -20, 10, 10, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		Knight: knightTable,
+		Bishop: bishopTable,
+		Rook: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			5, 10, 10, 10, 10, 10, 10, 5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			0, 0, 0, 5, 5, 0, 0, 0,
+		},
+		Queen: queenTable,
+		King: {
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-20, -30, -30, -40, -40, -30, -30, -20,
+			-10, -20, -20, -20, -20, -20, -20, -10,
+			20, 20, 0, 0, 0, 0, 20, 20,
+			20, 30, 10, 0, 0, 10, 30, 20,
+		},
+	},
+	Endgame: [6][64]int{
+		Pawn: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			80, 80, 80, 80, 80, 80, 80, 80,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			30, 30, 30, 30, 30, 30, 30, 30,
+			20, 20, 20, 20, 20, 20, 20, 20,
+			10, 10, 10, 10, 10, 10, 10, 10,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		Knight: knightTable,
+		Bishop: bishopTable,
+		Rook: {
+			0, 0, 0, 0, 0, 0, 0, 0,
+			10, 10, 10, 10, 10, 10, 10, 10,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		Queen: queenTable,
+		King: {
+			-50, -40, -30, -20, -20, -30, -40, -50,
+			-30, -20, -10, 0, 0, -10, -20, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 30, 40, 40, 30, -10, -30,
+			-30, -10, 20, 30, 30, 20, -10, -30,
+			-30, -30, 0, 0, 0, 0, -30, -30,
+			-50, -30, -30, -30, -30, -30, -30, -50,
+		},
+	},
+}
+
+// Minor pieces and the queen want the centre in every phase of the game
+var (
+	knightTable = [64]int{
+		-50, -40, -30, -30, -30, -30, -40, -50,
+		-40, -20, 0, 0, 0, 0, -20, -40,
+		-30, 0, 10, 15, 15, 10, 0, -30,
+		-30, 5, 15, 20, 20, 15, 5, -30,
+		-30, 0, 15, 20, 20, 15, 0, -30,
+		-30, 5, 10, 15, 15, 10, 5, -30,
+		-40, -20, 0, 5, 5, 0, -20, -40,
+		-50, -40, -30, -30, -30, -30, -40, -50,
+	}
+	bishopTable = [64]int{
+		-20, -10, -10, -10, -10, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 10, 10, 5, 0, -10,
+		-10, 5, 5, 10, 10, 5, 5, -10,
+		-10, 0, 10, 10, 10, 10, 0, -10,
+		-10, 10, 10, 10, 10, 10, 10, -10,
+		-10, 5, 0, 0, 0, 0, 5, -10,
+		-20, -10, -10, -10, -10, -10, -10, -20,
+	}
+	queenTable = [64]int{
+		-20, -10, -10, -5, -5, -10, -10, -20,
+		-10, 0, 0, 0, 0, 0, 0, -10,
+		-10, 0, 5, 5, 5, 5, 0, -10,
+		-5, 0, 5, 5, 5, 5, 0, -5,
+		0, 0, 5, 5, 5, 5, 0, -5,
+		-10, 5, 5, 5, 5, 5, 0, -10,
+		-10, 0, 5, 0, 0, 0, 0, -10,
+		-20, -10, -10, -5, -5, -10, -10, -20,
+	}
+)
+
+// The tables in use, indexed by square for both colours, Black's being White's mirrored
+var pstMiddlegame, pstEndgame [2][6][65]int
+
+func init() {
+	SetPieceSquareTables(&DefaultPieceSquareTables)
+}
+
+// SetPieceSquareTables replaces the tables used by the evaluation, it must not be called during a search
+func SetPieceSquareTables(tables *PieceSquareTables) {
+	for ptype := Pawn; ptype <= King; ptype++ {
+		for sq := Square(1); sq <= 64; sq++ {
+			file, rank := int(File(sq)), int(Rank(sq))
+			white := (8-rank)*8 + file - 1
+			black := (rank-1)*8 + file - 1
+
+			pstMiddlegame[White][ptype][sq] = tables.Middlegame[ptype][white]
+			pstMiddlegame[Black][ptype][sq] = tables.Middlegame[ptype][black]
+			pstEndgame[White][ptype][sq] = tables.Endgame[ptype][white]
+			pstEndgame[Black][ptype][sq] = tables.Endgame[ptype][black]
+		}
+	}
+}
+
+var pstTypeNames = [6]string{"pawn", "knight", "bishop", "rook", "queen", "king"}
+
+// LoadPieceSquareTables reads the tables from a file and uses them in the evaluation
+func LoadPieceSquareTables(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tables, err := ReadPieceSquareTables(file)
+	if err != nil {
+		return err
+	}
+	SetPieceSquareTables(tables)
+	return nil
+}
+
+// ReadPieceSquareTables reads tables in the format written by Write. A table starts with a line like
+// "knight middlegame" or "king endgame", followed by its 64 values. Tables left out keep their default values.
+func ReadPieceSquareTables(r io.Reader) (*PieceSquareTables, error) {
+	tables := DefaultPieceSquareTables
+	var table *[64]int
+	filled := 64
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			if filled < 64 {
+				return nil, fmt.Errorf("piece-square tables line %d: the table before has %d values, not 64", lineNumber, filled)
+			}
+			if table = tables.lookup(fields); table == nil {
+				return nil, fmt.Errorf("piece-square tables line %d: unknown table %q", lineNumber, line)
+			}
+			filled = 0
+			continue
+		}
+
+		for _, field := range fields {
+			value, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("piece-square tables line %d: %w", lineNumber, err)
+			}
+			if table == nil || filled == 64 {
+				return nil, fmt.Errorf("piece-square tables line %d: value outside of a table", lineNumber)
+			}
+			table[filled] = value
+			filled++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if filled < 64 {
+		return nil, fmt.Errorf("piece-square tables: the last table has %d values, not 64", filled)
+	}
+
+	return &tables, nil
+}
+
+func (tables *PieceSquareTables) lookup(fields []string) *[64]int {
+	if len(fields) != 2 {
+		return nil
+	}
+	for ptype, name := range pstTypeNames {
+		if fields[0] != name {
+			continue
+		}
+		switch fields[1] {
+		case "middlegame":
+			return &tables.Middlegame[ptype]
+		case "endgame":
+			return &tables.Endgame[ptype]
+		}
+	}
+	return nil
+}
+
+// Write the tables in the format read by ReadPieceSquareTables, as a starting point for tuning
+func (tables *PieceSquareTables) Write(w io.Writer) error {
+	writer := bufio.NewWriter(w)
+	for ptype, name := range pstTypeNames {
+		for _, phase := range []string{"middlegame", "endgame"} {
+			if ptype > 0 || phase == "endgame" {
+				writer.WriteString("\n")
+			}
+			table := tables.lookup([]string{name, phase})
+			fmt.Fprintf(writer, "%s %s\n", name, phase)
+			for row := 0; row < 8; row++ {
+				for col := 0; col < 8; col++ {
+					fmt.Fprintf(writer, "%4d", table[row*8+col])
+				}
+				writer.WriteString("\n")
+			}
+		}
+	}
+	return writer.Flush()
+}
+
+// gamePhase goes from MaxPhase with all pieces on the board, to 0 with only kings and pawns left
+func gamePhase(pos *Position) int {
+	phase := 0
+	for ptype := Knight; ptype <= Queen; ptype++ {
+		count := pos.pieceBitboards[White][ptype].Count() + pos.pieceBitboards[Black][ptype].Count()
+		phase += phaseWeights[ptype] * count
+	}
+	// Promotions can give more than the starting material
+	return min(phase, MaxPhase)
+}
+
+// taper blends the middlegame and the endgame score by the phase of the game
+func taper(middlegame, endgame, phase int) int {
+	return (middlegame*phase + endgame*(MaxPhase-phase)) / MaxPhase
+}
+
+// pieceScores is the material and the square of the piece, from White's side
+func pieceScores(piece Piece, sq Square) (middlegame, endgame int) {
+	if piece.PType == NoPiece {
+		return 0, 0
+	}
+	value := PieceValue(piece.PType)
+	middlegame = value + pstMiddlegame[piece.Color][piece.PType][sq]
+	endgame = value + pstEndgame[piece.Color][piece.PType][sq]
+	if piece.Color == Black {
+		return -middlegame, -endgame
+	}
+	return middlegame, endgame
+}
+
+// ComputeScores sums the material and piece-square scores from scratch.
+// The sums are kept up to date in MakeMove and UndoMove, so this is only needed when setting up a position,
+// or when the tables change.
+func (pos *Position) ComputeScores() (middlegame, endgame int) {
+	for sq := Square(1); sq <= 64; sq++ {
+		mg, eg := pieceScores(pos.Board[sq], sq)
+		middlegame += mg
+		endgame += eg
+	}
+	return middlegame, endgame
+}
+
+// Used in debug mode, like checkHash
+func (pos *Position) checkScores() {
+	if middlegame, endgame := pos.ComputeScores(); pos.middlegame != middlegame || pos.endgame != endgame {
+		panic(fmt.Sprintf("evaluation sums %d/%d, expected %d/%d, at %s", pos.middlegame, pos.endgame, middlegame, endgame, FEN(pos)))
+	}
+}
@@ -0,0 +1,119 @@
+package engine
+
+type GameResult int8
+
+const (
+	Ongoing GameResult = iota
+	WhiteWins
+	BlackWins
+	DrawByStalemate
+	DrawByRepetition
+	DrawByFiftyMoveRule
+	DrawByInsufficientMaterial
+)
+
+func (result GameResult) String() string {
+	switch result {
+	case WhiteWins:
+		return "1-0 (checkmate)"
+	case BlackWins:
+		return "0-1 (checkmate)"
+	case DrawByStalemate:
+		return "1/2-1/2 (stalemate)"
+	case DrawByRepetition:
+		return "1/2-1/2 (threefold repetition)"
+	case DrawByFiftyMoveRule:
+		return "1/2-1/2 (fifty-move rule)"
+	case DrawByInsufficientMaterial:
+		return "1/2-1/2 (insufficient material)"
+	default:
+		return "*"
+	}
+}
+
+func (result GameResult) IsDraw() bool {
+	return result >= DrawByStalemate
+}
+
+// GameResult tells if the game is over, and why.
+// Checkmate takes precedence over the draw rules, as a mate on the move that completes the fifty moves still counts.
+func (pos *Position) GameResult() GameResult {
+	moves := LegalMoves(pos)
+
+	if len(moves) == 0 {
+		if pos.InCheck() {
+			if pos.ColorToMove == White {
+				return BlackWins
+			}
+			return WhiteWins
+		}
+		return DrawByStalemate
+	}
+
+	if pos.IsInsufficientMaterial() {
+		return DrawByInsufficientMaterial
+	}
+
+	if pos.Repetitions() >= 2 {
+		return DrawByRepetition
+	}
+
+	if pos.Rule50 >= 100 {
+		return DrawByFiftyMoveRule
+	}
+
+	return Ongoing
+}
+
+// Repetitions counts how many times the current position has occurred before in the game.
+// Only positions since the last capture or pawn move can be the same.
+func (pos *Position) Repetitions() int {
+	count := 0
+
+	// The history before the position was set up is unknown
+	plies := min(int(pos.Rule50), len(pos.prevStates))
+
+	// The same side has to be to move, and it takes at least four plies to get back
+	for back := 4; back <= plies; back += 2 {
+		if pos.prevStates[len(pos.prevStates)-back].Hash == pos.Hash {
+			count++
+		}
+	}
+
+	return count
+}
+
+// IsInsufficientMaterial is true if no sequence of legal moves can lead to a checkmate, like KvK, KBvK and KNvK.
+func (pos *Position) IsInsufficientMaterial() bool {
+	for _, color := range []Color{White, Black} {
+		if pos.pieceBitboards[color][Pawn]|pos.pieceBitboards[color][Rook]|pos.pieceBitboards[color][Queen] != 0 {
+			return false
+		}
+	}
+
+	knights := pos.pieceBitboards[White][Knight] | pos.pieceBitboards[Black][Knight]
+	bishops := pos.pieceBitboards[White][Bishop] | pos.pieceBitboards[Black][Bishop]
+
+	if (knights | bishops).Count() <= 1 {
+		return true
+	}
+
+	// Any number of bishops, which are all on the same color, can't mate
+	return knights == 0 && (bishops&LightSquaresBB == 0 || bishops&DarkSquaresBB == 0)
+}
+
+// isDrawInSearch scores a single repetition as a draw, unlike GameResult.
+// If repeating was the best either side could do, it can be repeated again.
+// The fifty-move rule is left to isFiftyMoveDraw, as it has to give way to a mate.
+func (pos *Position) isDrawInSearch() bool {
+	return pos.Repetitions() >= 1 || pos.IsInsufficientMaterial()
+}
+
+// isFiftyMoveDraw is the fifty-move rule as GameResult applies it, a mate on the move that completes the fifty moves still counts
+func (pos *Position) isFiftyMoveDraw() bool {
+	if pos.Rule50 < 100 {
+		return false
+	}
+	// Generating the moves is only needed in check, and this rarely comes up in a search
+	return !pos.InCheck() || len(LegalMoves(pos)) > 0
+}
@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Standard Algebraic Notation, like "Nbd7", "exd5", "e8=Q+" and "O-O".
+// Reference: https://www.chessprogramming.org/Algebraic_Chess_Notation#Standard_Algebraic_Notation_.28SAN.29
+
+var ErrAmbiguousMove = errors.New("ambiguous move")
+
+var sanPieceLetters = map[PType]byte{
+	Knight: 'N',
+	Bishop: 'B',
+	Rook:   'R',
+	Queen:  'Q',
+	King:   'K',
+}
+
+// SAN of a legal move in the position
+func (pos *Position) SAN(move Move) string {
+	var san strings.Builder
+
+	piece := pos.Board[move.From]
+
+	switch {
+	case move.Flag == Castling && File(move.To) == 7:
+		san.WriteString("O-O")
+	case move.Flag == Castling:
+		san.WriteString("O-O-O")
+	case piece.PType == Pawn:
+		if pos.isCapture(move) {
+			san.WriteByte(byte(FileRune[File(move.From)]))
+			san.WriteByte('x')
+		}
+		san.WriteString(move.To.String())
+		if move.Flag.IsPromotion() {
+			san.WriteByte('=')
+			san.WriteByte(sanPieceLetters[promotionPType(move.Flag)])
+		}
+	default:
+		san.WriteByte(sanPieceLetters[piece.PType])
+		san.WriteString(pos.disambiguation(move))
+		if pos.isCapture(move) {
+			san.WriteByte('x')
+		}
+		san.WriteString(move.To.String())
+	}
+
+	// Check and checkmate
+	pos.MakeMove(move)
+	if pos.InCheck() {
+		var buffer MoveBuffer
+		if len(GenerateLegalMoves(pos, &buffer)) == 0 {
+			san.WriteByte('#')
+		} else {
+			san.WriteByte('+')
+		}
+	}
+	pos.UndoMove(move)
+
+	return san.String()
+}
+
+// The from file, rank or square needed to tell the move apart from moves of the same piece type to the same square.
+// The file is preferred over the rank.
+func (pos *Position) disambiguation(move Move) string {
+	ptype := pos.Board[move.From].PType
+
+	ambiguous, sameFile, sameRank := false, false, false
+	for _, other := range LegalMoves(pos) {
+		if other.To != move.To || other.From == move.From || pos.Board[other.From].PType != ptype {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || File(other.From) == File(move.From)
+		sameRank = sameRank || Rank(other.From) == Rank(move.From)
+	}
+
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return string(FileRune[File(move.From)])
+	case !sameRank:
+		return fmt.Sprint(Rank(move.From))
+	default:
+		return move.From.String()
+	}
+}
+
+// SANs of the moves, played one after another from the position
+func (pos *Position) SANLine(moves []Move) string {
+	cpy := pos.Copy()
+
+	sans := make([]string, len(moves))
+	for i, move := range moves {
+		sans[i] = cpy.SAN(move)
+		cpy.MakeMove(move)
+	}
+	return strings.Join(sans, " ")
+}
+
+// ParseSAN finds the legal move written in SAN. Common variants are accepted as well,
+// like "0-0" for castling, a missing "+" or "x", and promotions without "=" as in "e8Q".
+func ParseSAN(pos *Position, san string) (Move, error) {
+	text := strings.TrimRight(san, "+#!?")
+
+	switch text {
+	case "O-O", "0-0":
+		return pos.findSANMove(san, King, 0, 0, pos.GetKingSquare(pos.ColorToMove)+2, NoFlag, true)
+	case "O-O-O", "0-0-0":
+		return pos.findSANMove(san, King, 0, 0, pos.GetKingSquare(pos.ColorToMove)-2, NoFlag, true)
+	}
+
+	ptype := Pawn
+	if len(text) > 0 && strings.IndexByte("NBRQK", text[0]) >= 0 {
+		ptype = pieceFromSANLetter(text[0])
+		text = text[1:]
+	}
+
+	// Promotion, "=Q" or "Q" at the end
+	promotion := NoFlag
+	if len(text) > 0 && strings.IndexByte("NBRQ", text[len(text)-1]) >= 0 && ptype == Pawn {
+		promotion = promotionFlag(pieceFromSANLetter(text[len(text)-1]))
+		text = strings.TrimSuffix(text[:len(text)-1], "=")
+	}
+
+	if len(text) < 2 {
+		return Move{}, fmt.Errorf("%w: %s", ErrInvalidMove, san)
+	}
+	to, ok := parseSquare(text[len(text)-2:])
+	if !ok {
+		return Move{}, fmt.Errorf("%w: %s", ErrInvalidMove, san)
+	}
+
+	// What is left is the disambiguation, and the capture sign
+	var fromFile, fromRank int8
+	for _, char := range strings.TrimSuffix(text[:len(text)-2], "x") {
+		switch {
+		case 'a' <= char && char <= 'h':
+			fromFile = int8(char-'a') + 1
+		case '1' <= char && char <= '8':
+			fromRank = int8(char-'1') + 1
+		default:
+			return Move{}, fmt.Errorf("%w: %s", ErrInvalidMove, san)
+		}
+	}
+
+	return pos.findSANMove(san, ptype, fromFile, fromRank, to, promotion, false)
+}
+
+// The single legal move matching the parsed SAN, a file or rank of 0 matches any
+func (pos *Position) findSANMove(san string, ptype PType, fromFile, fromRank int8, to Square, promotion MoveFlag, castling bool) (Move, error) {
+	found := NilMove()
+	for _, move := range LegalMoves(pos) {
+		if move.To != to || pos.Board[move.From].PType != ptype ||
+			(fromFile != 0 && File(move.From) != fromFile) ||
+			(fromRank != 0 && Rank(move.From) != fromRank) ||
+			(castling != (move.Flag == Castling)) {
+			continue
+		}
+		if move.Flag.IsPromotion() && move.Flag != promotion {
+			continue
+		}
+		if promotion != NoFlag && move.Flag != promotion {
+			continue
+		}
+
+		if found != NilMove() {
+			return Move{}, fmt.Errorf("%w: %s", ErrAmbiguousMove, san)
+		}
+		found = move
+	}
+
+	if found == NilMove() {
+		return Move{}, fmt.Errorf("%w: %s", ErrIllegalMove, san)
+	}
+	return found, nil
+}
+
+// ParseMove reads a move in either UCI or SAN notation
+func ParseMove(pos *Position, text string) (Move, error) {
+	if move, err := ParseUCIMove(pos, text); err == nil && IsMoveValid(pos, move) {
+		return move, nil
+	}
+	return ParseSAN(pos, text)
+}
+
+// MakeMoves plays moves in UCI or SAN notation on the position, it stops at the first invalid or illegal move.
+func MakeMoves(pos *Position, moves []string) error {
+	for _, text := range moves {
+		move, err := ParseMove(pos, text)
+		if err != nil {
+			return err
+		}
+		pos.MakeMove(move)
+	}
+	return nil
+}
+
+func parseSquare(text string) (Square, bool) {
+	if len(text) != 2 || text[0] < 'a' || 'h' < text[0] || text[1] < '1' || '8' < text[1] {
+		return 0, false
+	}
+	return DeriveSquare(int(text[0]-'a')+1, int(text[1]-'0')), true
+}
+
+func pieceFromSANLetter(letter byte) PType {
+	for ptype, l := range sanPieceLetters {
+		if l == letter {
+			return ptype
+		}
+	}
+	return NoPiece
+}
+
+func promotionPType(flag MoveFlag) PType {
+	switch flag {
+	case PromotionToQueen:
+		return Queen
+	case PromotionToKnight:
+		return Knight
+	case PromotionToRook:
+		return Rook
+	case PromotionToBishop:
+		return Bishop
+	default:
+		return NoPiece
+	}
+}
+
+func promotionFlag(ptype PType) MoveFlag {
+	switch ptype {
+	case Queen:
+		return PromotionToQueen
+	case Knight:
+		return PromotionToKnight
+	case Rook:
+		return PromotionToRook
+	case Bishop:
+		return PromotionToBishop
+	default:
+		return NoFlag
+	}
+}
@@ -2,116 +2,444 @@ package engine
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
+	// Depth searched when the search has no other limits
 	SearchDepth = 6
+
+	MaxSearchDepth = 64
+
+	// Maximum distance from the root, including the quiescence search
+	MaxPly = 128
+
+	// How many nodes are searched between each look at the clock
+	timerCheckInterval = 2048
+
+	// Root moves are only reported with currmove once the search has run this long, to not flood the GUI
+	currMoveReportDelay = time.Second
+
+	MaxMultiPV = 256
+
+	MaxThreads = 256
 )
 
+// AnalysisLine is one of the best root moves, with its score and principal variation
+type AnalysisLine struct {
+	Move  Move
+	Score int
+	PV    []Move
+	Depth int
+}
+
 type Search struct {
 	pos        Position
 	SearchOver bool
 	BestMove   Move
+	Score      int    // Score of the best move, from the side to move's perspective
+	PV         []Move // Principal variation, the expected line of play starting with the best move
+
+	// Number of best root moves searched with their own score and principal variation, 1 unless analysing
+	MultiPV int
+	Lines   []AnalysisLine
+
+	// Number of threads searching the position. The helper threads only share their results through the
+	// transposition table, the main thread decides the best move.
+	Threads int
+	helpers []*Search
+	main    *Search // The main thread of a helper, nil for the main thread
+
+	// Where the UCI info lines are written to
+	Output io.Writer
+
+	nodesSearched atomic.Int64 // Read by the main thread while a helper searches
+	selDepth      int          // Highest ply reached, including the quiescence search
+
+	// Triangular PV table, pvTable[ply] holds the best line found from ply, up to pvLength[ply]
+	pvTable  [MaxPly + 1][MaxPly + 1]Move
+	pvLength [MaxPly + 1]int
+
+	// The moves of each ply are generated into its own buffer, such that the search doesn't allocate
+	moveBuffers [MaxPly + 1]MoveBuffer
 
-	nodesSearched int
+	limits SearchLimits
+	timer  *Timer
 
-	timer Timer
+	tt *TranspositionTable
+
+	// Every thread has its own pawn table, it is too small to be worth sharing
+	pawnTable *PawnTable
 }
 
-func NewSearch(pos *Position) (search Search) {
-	return Search{
-		pos:           *pos,
-		SearchOver:    false,
-		BestMove:      NilMove(),
-		nodesSearched: 0,
-		timer:         NewTimer(),
+// NewSearch sets up a search of the position. The transposition table is kept between searches by the caller,
+// if it is nil a new table of the default size is used.
+func NewSearch(pos *Position, limits SearchLimits, tt *TranspositionTable) *Search {
+	if tt == nil {
+		tt = NewTranspositionTable(DefaultHashMB)
+	}
+
+	search := &Search{
+		pos:        *pos.Copy(),
+		SearchOver: false,
+		BestMove:   NilMove(),
+		MultiPV:    1,
+		Threads:    1,
+		Output:     os.Stdout,
+		limits:     limits,
+		timer:      NewTimer(),
+		tt:         tt,
+		pawnTable:  NewPawnTable(DefaultPawnTableEntries),
 	}
+	search.timer.Allocate(limits, pos.ColorToMove)
+	return search
 }
 
 func (search *Search) Search() {
-	bestMove, bestScore := Move{}, NegativeInfinity
+	search.SearchOver = false
+	search.nodesSearched.Store(0)
+	search.PV = nil
+	search.Lines = nil
+	search.helpers = nil
+	search.timer.Start()
+
+	search.BestMove, search.Score = NilMove(), 0
+
+	numRootMoves := len(LegalMoves(&search.pos))
+	if numRootMoves == 0 {
+		if search.pos.InCheck() {
+			search.Score = -MateScore
+		}
+		return
+	}
+	multiPV := min(max(search.MultiPV, 1), numRootMoves)
+
+	// Lazy SMP, the helpers search the same position until the main thread is done.
+	// They share the node limit, all helpers are set up before any starts as they count each other's nodes.
+	for i := 1; i < min(search.Threads, MaxThreads); i++ {
+		helper := NewSearch(&search.pos, SearchLimits{Infinite: true, Nodes: search.limits.Nodes}, search.tt)
+		helper.Output = io.Discard
+		helper.main = search
+		helper.timer.Start()
+		search.helpers = append(search.helpers, helper)
+	}
+	var wg sync.WaitGroup
+	for i, helper := range search.helpers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Half of the helpers start a depth ahead, such that the threads don't all search the same tree
+			helper.iterativeDeepening(2-i%2, 1)
+		}()
+	}
+
+	search.iterativeDeepening(1, multiPV)
+
+	for _, helper := range search.helpers {
+		helper.Stop()
+	}
+	wg.Wait()
+
+	if len(search.Lines) > 0 {
+		search.BestMove = search.Lines[0].Move
+		search.Score = search.Lines[0].Score
+		search.PV = search.Lines[0].PV
+	}
+}
+
+func (search *Search) iterativeDeepening(startDepth int, multiPV int) {
+	for depth := startDepth; depth <= search.maxDepth(); depth++ {
+		search.selDepth = 0
+
+		// Each line is searched without the moves of the better lines
+		lines := make([]AnalysisLine, 0, multiPV)
+		excluded := make([]Move, 0, multiPV)
+		for len(lines) < multiPV {
+			move, score := search.rootAlphaBeta(depth, excluded)
+			if search.SearchOver {
+				// Stopped before the first iteration finished, the best move so far has to do
+				if search.Lines == nil && len(lines) == 0 {
+					if move == NilMove() {
+						move = LegalMoves(&search.pos)[0]
+					}
+					lines = append(lines, AnalysisLine{Move: move, Score: score, PV: []Move{move}, Depth: depth})
+				}
+				break
+			}
 
-	for depth := 1; depth <= SearchDepth; depth++ {
-		move, score := search.rootAlphaBeta(depth)
+			pv := make([]Move, search.pvLength[0])
+			copy(pv, search.pvTable[0][:search.pvLength[0]])
+			lines = append(lines, AnalysisLine{Move: move, Score: score, PV: pv, Depth: depth})
+			excluded = append(excluded, move)
+		}
 
+		// An aborted iteration can't be trusted, only use it if nothing else was found
 		if search.SearchOver {
-			search.BestMove = bestMove
+			if search.Lines == nil && len(lines) > 0 {
+				search.Lines = lines
+			}
+			break
 		}
 
-		if score > bestScore {
-			bestMove, bestScore = move, score
+		search.Lines = lines
+		search.searchInfo(depth)
+
+		if !search.timer.CanStartIteration() || search.mateFound(lines[0].Score) {
+			break
 		}
+	}
+}
+
+// Nodes searched by all threads
+func (search *Search) Nodes() int {
+	if search.main != nil {
+		return search.main.Nodes()
+	}
+	nodes := search.nodesSearched.Load()
+	for _, helper := range search.helpers {
+		nodes += helper.nodesSearched.Load()
+	}
+	return int(nodes)
+}
+
+// Analyze searches the n best moves of the position to the default depth, best first.
+func Analyze(pos *Position, n int) []AnalysisLine {
+	search := NewSearch(pos, SearchLimits{}, nil)
+	search.MultiPV = n
+	search.Output = io.Discard
+
+	search.Search()
+
+	return search.Lines
+}
 
-		search.searchInfo(depth, bestScore, bestMove)
+// PonderMove is the expected reply to the best move, or the nil move if it is not known
+func (search *Search) PonderMove() Move {
+	if len(search.PV) < 2 {
+		return NilMove()
 	}
+	return search.PV[1]
+}
+
+// updatePV sets the line at ply to the move, followed by the best line found after it
+func (search *Search) updatePV(ply int, move Move) {
+	search.pvTable[ply][ply] = move
+	copy(search.pvTable[ply][ply+1:search.pvLength[ply+1]], search.pvTable[ply+1][ply+1:search.pvLength[ply+1]])
+	search.pvLength[ply] = max(search.pvLength[ply+1], ply+1)
+}
+
+// With "go mate N" the search is done when a mate in N moves or less is found
+func (search *Search) mateFound(score int) bool {
+	return search.limits.Mate > 0 && score >= MateScore-(2*search.limits.Mate-1)
+}
+
+// Stop ends a running search, it is safe to call from another goroutine
+func (search *Search) Stop() {
+	search.timer.Stop()
+}
 
-	search.BestMove = bestMove
+// PonderHit switches a pondering search to its time limits, it is safe to call from another goroutine
+func (search *Search) PonderHit() {
+	search.timer.PonderHit()
+}
+
+func (search *Search) maxDepth() int {
+	switch {
+	case search.limits.Depth > 0:
+		return min(search.limits.Depth, MaxSearchDepth)
+	case search.limits.Mate > 0:
+		return min(2*search.limits.Mate, MaxSearchDepth)
+	case search.limits.Timed() || search.limits.Infinite || search.limits.Nodes > 0:
+		return MaxSearchDepth
+	default:
+		return SearchDepth
+	}
+}
+
+// shouldStop polls the timer and the node limit, and marks the search as over when either is exceeded.
+// The node limit counts the nodes of all threads.
+func (search *Search) shouldStop() bool {
+	if search.nodesSearched.Load()%timerCheckInterval == 0 {
+		search.timer.Check()
+	}
+	if search.timer.Stopped() || (search.limits.Nodes > 0 && search.Nodes() >= search.limits.Nodes) {
+		search.SearchOver = true
+	}
+	return search.SearchOver
 }
 
-func (search *Search) rootAlphaBeta(depth int) (Move, int) {
+// rootAlphaBeta searches every root move, except the excluded ones
+func (search *Search) rootAlphaBeta(depth int, excluded []Move) (Move, int) {
 	alpha, beta := NegativeInfinity, PositiveInfinity
-	search.nodesSearched = 0
 
-	bestMove := Move{}
+	bestMove := NilMove()
+	search.pvLength[0] = 0
 
-	moves := LegalMoves(&search.pos)
-	search.orderMoves(&moves)
+	moves := search.generateMoves(0)
+	if len(moves) == 0 {
+		if search.pos.InCheck() {
+			return NilMove(), -MateScore
+		}
+		return NilMove(), DrawScore
+	}
+	search.orderMoves(&moves, search.hashMove())
 
 	for i := 0; i < len(moves); i++ {
 		move := moves[i]
 
+		if slices.Contains(excluded, move) {
+			continue
+		}
+
+		if search.timer.Elapsed() > currMoveReportDelay {
+			fmt.Fprintf(search.Output, "info depth %d currmove %s currmovenumber %d\n", depth, move.UCIString(), i+1)
+		}
+
 		search.pos.MakeMove(move)
-		score := -search.alphaBeta(-beta, -alpha, depth-1)
+		score := -search.alphaBeta(-beta, -alpha, depth-1, 1)
 		search.pos.UndoMove(move)
 
-		// fmt.Println(" Move: ", move.UCIString(), " Score: ", score)
-		if score == PositiveInfinity {
-			return move, beta
+		if search.SearchOver {
+			break
 		}
 
 		if score > alpha {
 			alpha = score
 			bestMove = move
+			search.updatePV(0, move)
 		}
 	}
 
+	// Only the best line is the true result of the position
+	if !search.SearchOver && len(excluded) == 0 {
+		search.tt.Store(search.pos.Hash, bestMove, scoreToTT(alpha, 0), depth, BoundExact)
+	}
+
 	return bestMove, alpha
 }
 
-func (search *Search) alphaBeta(alpha, beta, depthLeft int) int {
-	search.nodesSearched++
+// The legal moves of the current position, in the buffer of the ply
+func (search *Search) generateMoves(ply int) MoveList {
+	return GenerateLegalMoves(&search.pos, &search.moveBuffers[ply])
+}
+
+// The best move stored for the current position, used to search it first
+func (search *Search) hashMove() Move {
+	if entry, found := search.tt.Probe(search.pos.Hash); found {
+		return entry.Move
+	}
+	return NilMove()
+}
+
+// ply is the distance from the root
+func (search *Search) alphaBeta(alpha, beta, depthLeft, ply int) int {
+	search.nodesSearched.Add(1)
+	search.pvLength[ply] = ply
+	search.selDepth = max(search.selDepth, ply)
+	if search.shouldStop() {
+		return 0
+	}
+
+	if search.pos.isDrawInSearch() || search.pos.isFiftyMoveDraw() {
+		return DrawScore
+	}
+
+	if ply >= MaxPly {
+		return search.evaluate()
+	}
+
+	// Mate distance pruning, no line from here can beat a mate which is already found closer to the root
+	alpha = max(alpha, -MateScore+ply)
+	beta = min(beta, MateScore-ply-1)
+	if alpha >= beta {
+		return alpha
+	}
 
 	if depthLeft == 0 {
-		return search.quiesce(alpha, beta)
+		return search.quiesce(alpha, beta, ply)
 	}
+
+	// Use the stored result, if it was searched at least as deep
+	hashMove := NilMove()
+	if entry, found := search.tt.Probe(search.pos.Hash); found {
+		hashMove = entry.Move
+		if int(entry.Depth) >= depthLeft {
+			score := scoreFromTT(int(entry.Score), ply)
+			switch {
+			case entry.Bound == BoundExact,
+				entry.Bound == BoundLower && score >= beta,
+				entry.Bound == BoundUpper && score <= alpha:
+				return score
+			}
+		}
+	}
+
+	alphaOrig := alpha
 	bestValue := NegativeInfinity
+	bestMove := NilMove()
 
-	moves := LegalMoves(&search.pos)
-	search.orderMoves(&moves)
+	moves := search.generateMoves(ply)
+	if len(moves) == 0 {
+		if search.pos.InCheck() {
+			return -MateScore + ply
+		}
+		return DrawScore
+	}
+	search.orderMoves(&moves, hashMove)
 
 	for i := 0; i < len(moves); i++ {
 		move := moves[i]
 
 		search.pos.MakeMove(move)
-		score := -search.alphaBeta(-beta, -alpha, depthLeft-1)
+		score := -search.alphaBeta(-beta, -alpha, depthLeft-1, ply+1)
 		search.pos.UndoMove(move)
 
+		if search.SearchOver {
+			return 0
+		}
+
 		if score > bestValue {
 			bestValue = score
+			bestMove = move
 			if score > alpha {
 				alpha = score
+				search.updatePV(ply, move)
 			}
 		}
 		if score >= beta {
-			return bestValue
+			break
 		}
 	}
+
+	bound := BoundExact
+	if bestValue >= beta {
+		bound = BoundLower
+	} else if bestValue <= alphaOrig {
+		bound = BoundUpper
+	}
+	search.tt.Store(search.pos.Hash, bestMove, scoreToTT(bestValue, ply), depthLeft, bound)
+
 	return bestValue
 }
 
-func (search *Search) quiesce(alpha, beta int) int {
-	search.nodesSearched++
-	stand_pat := Evaluate(&search.pos)
+func (search *Search) quiesce(alpha, beta, ply int) int {
+	search.nodesSearched.Add(1)
+	search.selDepth = max(search.selDepth, ply)
+	if search.shouldStop() {
+		return 0
+	}
+
+	if ply >= MaxPly {
+		return search.evaluate()
+	}
+
+	stand_pat := search.evaluate()
 
 	if stand_pat >= beta {
 		return beta
@@ -120,8 +448,14 @@ func (search *Search) quiesce(alpha, beta int) int {
 		alpha = stand_pat
 	}
 
-	moves := LegalMoves(&search.pos)
-	search.orderMoves(&moves)
+	moves := search.generateMoves(ply)
+	if len(moves) == 0 {
+		if search.pos.InCheck() {
+			return -MateScore + ply
+		}
+		return DrawScore
+	}
+	search.orderMoves(&moves, NilMove())
 
 	for i := 0; i < len(moves); i++ {
 		move := moves[i]
@@ -129,7 +463,7 @@ func (search *Search) quiesce(alpha, beta int) int {
 			continue
 		}
 		search.pos.MakeMove(move)
-		score := -search.quiesce(-beta, -alpha)
+		score := -search.quiesce(-beta, -alpha, ply+1)
 		search.pos.UndoMove(move)
 
 		if score >= beta {
@@ -143,6 +477,11 @@ func (search *Search) quiesce(alpha, beta int) int {
 	return alpha
 }
 
+// evaluate is the score for the side to move, using the pawn table of the thread
+func (search *Search) evaluate() int {
+	return who2move(search.pos.ColorToMove) * evaluate(&search.pos, search.pawnTable)
+}
+
 func (pos *Position) isCapture(move Move) bool {
 	if move.Flag == EnPassentCapture {
 		return true
@@ -150,23 +489,26 @@ func (pos *Position) isCapture(move Move) bool {
 	return pos.Board[move.To].Color == pos.ColorToMove.opposite()
 }
 
-func (search *Search) orderMoves(moves *MoveList) {
-	var scores []int
+// The hash move is searched first, the rest are sorted by a guess of how good they are
+func (search *Search) orderMoves(moves *MoveList, hashMove Move) {
+	var scores [MaxMoves]int
 
 	for i := 0; i < len(*moves); i++ {
-		scores = append(scores, scoreMove((*moves)[i], &search.pos))
+		if (*moves)[i] == hashMove {
+			scores[i] = PositiveInfinity
+			continue
+		}
+		scores[i] = scoreMove((*moves)[i], &search.pos)
 	}
 
-	// Sort Moves based on scores
-	// Better scores first
-	for i := 0; i < len(*moves)-1; i++ {
-		for j := i + 1; j < len(*moves); j++ {
-			if scores[j] > scores[i] {
-				// swap
-				scores[j], scores[i] = scores[i], scores[j]
-				(*moves)[j], (*moves)[i] = (*moves)[i], (*moves)[j]
-			}
+	// Insertion sort, better scores first. The lists are short, and it keeps equal moves in generation order.
+	for i := 1; i < len(*moves); i++ {
+		score, move := scores[i], (*moves)[i]
+		j := i
+		for ; j > 0 && scores[j-1] < score; j-- {
+			scores[j], (*moves)[j] = scores[j-1], (*moves)[j-1]
 		}
+		scores[j], (*moves)[j] = score, move
 	}
 }
 
@@ -191,11 +533,35 @@ func scoreMove(move Move, pos *Position) int {
 	return scoreGuess
 }
 
-func (search *Search) searchInfo(depth int, bestScore int, bestMove Move) {
-	fmt.Printf(
-		"info depth %d score %d nodes %d bestmove %s\n",
-		depth, bestScore,
-		search.nodesSearched,
-		bestMove.UCIString(),
-	)
+func (search *Search) searchInfo(depth int) {
+	elapsed := search.timer.Elapsed()
+	nodes := search.Nodes()
+	nps := int(float64(nodes) / max(elapsed.Seconds(), 0.001))
+
+	for i, line := range search.Lines {
+		var pv strings.Builder
+		for _, move := range line.PV {
+			pv.WriteString(" ")
+			pv.WriteString(move.UCIString())
+		}
+
+		fmt.Fprintf(search.Output,
+			"info depth %d seldepth %d multipv %d score %s nodes %d nps %d time %d hashfull %d pv%s\n",
+			depth, search.selDepth, i+1, FormatScore(line.Score),
+			nodes, nps, elapsed.Milliseconds(),
+			search.tt.Hashfull(), pv.String(),
+		)
+	}
+}
+
+// FormatScore gives the score as in UCI info, "cp <x>" or "mate <y>" where y is in moves, not plies.
+// A negative y means the engine is getting mated.
+func FormatScore(score int) string {
+	if score >= MateThreshold {
+		return fmt.Sprintf("mate %d", (MateScore-score+1)/2)
+	}
+	if score <= -MateThreshold {
+		return fmt.Sprintf("mate %d", -(MateScore+score)/2)
+	}
+	return fmt.Sprintf("cp %d", score)
 }
@@ -1,29 +1,135 @@
 package engine
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Time kept in reserve for communication lag with the GUI, in milliseconds
+	MoveOverhead = 50
+
+	// Number of moves the remaining time is spread over, when the GUI does not send movestogo
+	DefaultMovesToGo = 30
+)
+
+// SearchLimits holds the constraints of a search, as given by the UCI "go" command.
+// All times are in milliseconds, a zero value means no limit.
+type SearchLimits struct {
+	WTime     int64
+	BTime     int64
+	WInc      int64
+	BInc      int64
+	MovesToGo int
+	MoveTime  int64
+
+	Depth    int
+	Nodes    int
+	Mate     int
+	Infinite bool
+
+	// Searching the expected reply to the ponder move, the clock only counts once "ponderhit" is sent
+	Ponder bool
+}
+
+// Timed is true if the search has to stop because of the clock
+func (limits *SearchLimits) Timed() bool {
+	return !limits.Infinite && (limits.MoveTime > 0 || limits.WTime > 0 || limits.BTime > 0)
+}
 
 type Timer struct {
-	// UCI options, theses are apparently in nanoseconds
-	TimeLeft int64
-	MoveTime int64
+	// Set by the search itself when the time is up, or by another goroutine on "stop"
+	stop atomic.Bool
 
-	Stop        bool
+	// While pondering the time is not checked, "ponderhit" ends it from another goroutine
+	pondering atomic.Bool
+
+	// Time allocated for the move in milliseconds, 0 means no time limit
 	TimeForMove int64
-	stopTime    time.Time
+
+	startTime time.Time
+	stopTime  time.Time
 }
 
-func NewTimer() (tm Timer) {
-	return tm
+func NewTimer() *Timer {
+	return &Timer{}
 }
 
-func (tm *Timer) Start() {
-	tm.Stop = false
+// Allocate decides how much time the side to move may spend on the current move.
+func (tm *Timer) Allocate(limits SearchLimits, c2m Color) {
+	tm.TimeForMove = 0
+	tm.pondering.Store(limits.Ponder)
+
+	if !limits.Timed() {
+		return
+	}
+
+	if limits.MoveTime > 0 {
+		tm.TimeForMove = max(limits.MoveTime-MoveOverhead, 1)
+		return
+	}
+
+	timeLeft, inc := limits.WTime, limits.WInc
+	if c2m == Black {
+		timeLeft, inc = limits.BTime, limits.BInc
+	}
+
+	movesToGo := int64(limits.MovesToGo)
+	if movesToGo <= 0 {
+		movesToGo = DefaultMovesToGo
+	}
 
-	tm.stopTime = time.Now().Add(time.Duration(tm.MoveTime) * time.Millisecond)
+	allocated := timeLeft/movesToGo + inc*3/4
+
+	// Never use more than what is left on the clock, minus a safety margin
+	maxTime := max(timeLeft-MoveOverhead, 1)
+	if movesToGo > 1 {
+		maxTime = max(min(maxTime, timeLeft/2), 1)
+	}
+
+	tm.TimeForMove = max(min(allocated, maxTime), 1)
+}
+
+// Start the clock. A stop requested before the start is kept, such that an early "stop" is never lost.
+func (tm *Timer) Start() {
+	tm.startTime = time.Now()
+	tm.stopTime = tm.startTime.Add(time.Duration(tm.TimeForMove) * time.Millisecond)
 }
 
 func (tm *Timer) Check() {
-	if time.Now().After(tm.stopTime) {
-		tm.Stop = true
+	if tm.TimeForMove > 0 && !tm.pondering.Load() && time.Now().After(tm.stopTime) {
+		tm.stop.Store(true)
+	}
+}
+
+// Stop can be called from any goroutine to end the search as soon as possible
+func (tm *Timer) Stop() {
+	tm.stop.Store(true)
+}
+
+func (tm *Timer) Stopped() bool {
+	return tm.stop.Load()
+}
+
+// PonderHit starts the clock of a pondering search, it can be called from any goroutine.
+// The time used is counted from the start of the search, as the opponent played the expected move.
+func (tm *Timer) PonderHit() {
+	tm.pondering.Store(false)
+}
+
+func (tm *Timer) Pondering() bool {
+	return tm.pondering.Load()
+}
+
+// Elapsed time since the timer was started
+func (tm *Timer) Elapsed() time.Duration {
+	return time.Since(tm.startTime)
+}
+
+// CanStartIteration is false when the next iteration is unlikely to finish before the time runs out.
+func (tm *Timer) CanStartIteration() bool {
+	if tm.TimeForMove == 0 || tm.pondering.Load() {
+		return true
 	}
+	return tm.Elapsed() < time.Duration(tm.TimeForMove)*time.Millisecond/2
 }
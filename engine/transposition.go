@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	// Size of the transposition table in MB, as given by the UCI Hash option
+	DefaultHashMB = 16
+	MinHashMB     = 1
+	MaxHashMB     = 4096
+)
+
+// Bound tells how a stored score relates to the true score of the position
+type Bound uint8
+
+const (
+	BoundNone  Bound = iota
+	BoundExact       // The score is exact
+	BoundLower       // The search failed high, the true score is at least the score
+	BoundUpper       // The search failed low, the true score is at most the score
+)
+
+type TTEntry struct {
+	Key   uint64
+	Move  Move
+	Score int32
+	Depth int8
+	Bound Bound
+}
+
+// TranspositionTable is a fixed size hash table of search results, indexed by the Zobrist key.
+// It is shared by the search threads without locking, see ttSlot.
+type TranspositionTable struct {
+	entries []ttSlot
+	mask    uint64
+}
+
+// A slot holds the entry packed into one word, and the key xored with it.
+// A slot torn by two threads writing at once no longer matches its key, and is treated as empty.
+// Reference: https://www.chessprogramming.org/Shared_Hash_Table#Lockless
+type ttSlot struct {
+	key  atomic.Uint64
+	data atomic.Uint64
+}
+
+// Layout of the packed entry: score in the low 32 bits, then depth, bound, flag, from and to
+func packEntry(move Move, score int, depth int, bound Bound) uint64 {
+	return uint64(uint32(int32(score))) |
+		uint64(uint8(int8(depth)))<<32 |
+		uint64(bound&0x3)<<40 |
+		uint64(uint8(move.Flag)&0x7)<<42 |
+		uint64(uint8(move.From))<<45 |
+		uint64(uint8(move.To))<<53
+}
+
+func unpackEntry(key uint64, data uint64) TTEntry {
+	return TTEntry{
+		Key: key,
+		Move: Move{
+			From: Square(int8(uint8(data >> 45))),
+			To:   Square(int8(uint8(data >> 53))),
+			Flag: MoveFlag((data >> 42) & 0x7),
+		},
+		Score: int32(uint32(data)),
+		Depth: int8(uint8(data >> 32)),
+		Bound: Bound((data >> 40) & 0x3),
+	}
+}
+
+func NewTranspositionTable(sizeMB int) *TranspositionTable {
+	tt := &TranspositionTable{}
+	tt.Resize(sizeMB)
+	return tt
+}
+
+// Resize the table to at most sizeMB, this clears all entries
+func (tt *TranspositionTable) Resize(sizeMB int) {
+	sizeMB = min(max(sizeMB, MinHashMB), MaxHashMB)
+
+	// The number of entries is rounded down to a power of two, such that the index is a mask of the key
+	maxEntries := uint64(sizeMB) * 1024 * 1024 / uint64(unsafe.Sizeof(ttSlot{}))
+	numEntries := uint64(1)
+	for numEntries*2 <= maxEntries {
+		numEntries *= 2
+	}
+
+	tt.entries = make([]ttSlot, numEntries)
+	tt.mask = numEntries - 1
+}
+
+// Clear and Resize must not be called while a search is running
+func (tt *TranspositionTable) Clear() {
+	clear(tt.entries)
+}
+
+func (tt *TranspositionTable) Probe(key uint64) (TTEntry, bool) {
+	slot := &tt.entries[key&tt.mask]
+	data := slot.data.Load()
+	if slot.key.Load()^data != key {
+		return TTEntry{}, false
+	}
+	entry := unpackEntry(key, data)
+	return entry, entry.Bound != BoundNone
+}
+
+// Store a search result. Deeper results of the same position are kept over shallower ones.
+func (tt *TranspositionTable) Store(key uint64, move Move, score int, depth int, bound Bound) {
+	slot := &tt.entries[key&tt.mask]
+
+	if old, found := tt.Probe(key); found {
+		if int(old.Depth) > depth && bound != BoundExact {
+			return
+		}
+
+		// Keep the known best move, if the new result has none
+		if move == NilMove() {
+			move = old.Move
+		}
+	}
+
+	data := packEntry(move, score, depth, bound)
+	slot.key.Store(key ^ data)
+	slot.data.Store(data)
+}
+
+// Hashfull is the permille of the table in use, estimated from the first thousand entries
+func (tt *TranspositionTable) Hashfull() int {
+	sample := min(len(tt.entries), 1000)
+	used := 0
+	for i := 0; i < sample; i++ {
+		if Bound((tt.entries[i].data.Load()>>40)&0x3) != BoundNone {
+			used++
+		}
+	}
+	return used * 1000 / sample
+}
+
+// Mate scores are stored relative to the position, instead of the root,
+// such that they stay correct when the position is reached at another ply.
+func scoreToTT(score int, ply int) int {
+	if score >= MateThreshold {
+		return score + ply
+	}
+	if score <= -MateThreshold {
+		return score - ply
+	}
+	return score
+}
+
+func scoreFromTT(score int, ply int) int {
+	if score >= MateThreshold {
+		return score - ply
+	}
+	if score <= -MateThreshold {
+		return score + ply
+	}
+	return score
+}
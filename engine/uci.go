@@ -4,8 +4,14 @@
 package engine
 
 import (
+	"bytes"
 	"fmt"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"tactix/resources"
 )
 
 type UCI struct {
@@ -13,6 +19,21 @@ type UCI struct {
 	pos       *Position
 	open_book *OpeningBook
 
+	// A book set with the BookFile option, it is used instead of the built in book
+	bookFile     Book
+	ownBook      bool
+	bestBookMove bool
+
+	// The running search and a channel which is closed when it has reported its bestmove
+	search     *Search
+	searchDone chan struct{}
+
+	// Kept between searches, such that results of earlier moves can be reused
+	tt *TranspositionTable
+
+	multiPV int
+	threads int
+
 	// Options
 
 	Debug bool
@@ -22,7 +43,11 @@ func NewUCI(pos *Position) *UCI {
 	return &UCI{
 		options:   make(map[string]string),
 		pos:       pos,
-		open_book: NewOpeningBook(),
+		open_book: loadDefaultBook(),
+		tt:        NewTranspositionTable(DefaultHashMB),
+		multiPV:   1,
+		threads:   1,
+		ownBook:   true,
 
 		Debug: false,
 	}
@@ -37,10 +62,26 @@ func (uci *UCI) handleUCICommand(message string) {
 	switch fields[0] {
 	case "uci":
 		uci.respondUCI()
+	case "debug":
+		// The search reads DebugMode in MakeMove and UndoMove, it can't change under a running search
+		uci.StopSearch()
+		uci.Debug = len(fields) > 1 && fields[1] == "on"
+		DebugMode = uci.Debug
 	case "isready":
 		fmt.Print("readyok\n")
 	case "go":
 		uci.goCommand(message)
+	case "stop":
+		uci.StopSearch()
+	case "ponderhit":
+		if uci.search != nil {
+			uci.search.PonderHit()
+		}
+	case "ucinewgame":
+		uci.StopSearch()
+		uci.tt.Clear()
+	case "setoption":
+		uci.setOptionCommand(fields)
 	case "position":
 		uci.positionCommand(message)
 	default:
@@ -56,44 +97,311 @@ func (uci *UCI) respondUCI() {
 
 	// Engine Options
 	fmt.Print("option name OwnBook type check default true\n")
+	fmt.Print("option name BookFile type string default <empty>\n")
+	fmt.Print("option name BestBookMove type check default false\n")
+	fmt.Printf("option name Hash type spin default %d min %d max %d\n", DefaultHashMB, MinHashMB, MaxHashMB)
+	fmt.Print("option name Clear Hash type button\n")
+	fmt.Printf("option name MultiPV type spin default 1 min 1 max %d\n", MaxMultiPV)
+	fmt.Printf("option name Threads type spin default 1 min 1 max %d\n", MaxThreads)
+	fmt.Print("option name PSTFile type string default <empty>\n")
+	fmt.Print("option name KingSafetyFile type string default <empty>\n")
+	fmt.Print("option name Ponder type check default false\n")
 
 	fmt.Print("uciok\n")
 }
 
 func (uci *UCI) goCommand(message string) {
-	uci.pos.PrintHistory()
-	if uci.open_book.InBook(uci.pos.MoveHistory) {
-		move := uci.open_book.GetBookMove(uci.pos)
-		fmt.Println("BestMove: ", move.UCIString())
+	uci.StopSearch()
+
+	limits, err := parseGoCommand(message)
+	if err != nil {
+		fmt.Println("info string", err)
+		return
+	}
+
+	// The bestmove of a pondering search may only be sent after "ponderhit" or "stop", so the book is left out
+	if book := uci.book(); book != nil && !limits.Ponder {
+		if move, ok := book.Move(uci.pos); ok {
+			printBestMove(move, NilMove())
+			return
+		}
+	}
+
+	search := NewSearch(uci.pos, limits, uci.tt)
+	search.MultiPV = uci.multiPV
+	search.Threads = uci.threads
+	uci.startSearch(search)
+}
+
+// setOptionCommand handles "setoption name <id> [value <x>]", the id may contain spaces
+func (uci *UCI) setOptionCommand(fields []string) {
+	uci.StopSearch()
+
+	var name, value []string
+	target := &name
+	for _, field := range fields[1:] {
+		switch field {
+		case "name":
+			target = &name
+		case "value":
+			target = &value
+		default:
+			*target = append(*target, field)
+		}
+	}
+
+	id := strings.Join(name, " ")
+	uci.options[id] = strings.Join(value, " ")
+
+	switch strings.ToLower(id) {
+	case "hash":
+		sizeMB, err := strconv.Atoi(uci.options[id])
+		if err != nil {
+			fmt.Println("info string invalid Hash value:", uci.options[id])
+			return
+		}
+		uci.tt.Resize(sizeMB)
+	case "clear hash":
+		uci.tt.Clear()
+	case "multipv":
+		multiPV, err := strconv.Atoi(uci.options[id])
+		if err != nil {
+			fmt.Println("info string invalid MultiPV value:", uci.options[id])
+			return
+		}
+		uci.multiPV = min(max(multiPV, 1), MaxMultiPV)
+	case "threads":
+		threads, err := strconv.Atoi(uci.options[id])
+		if err != nil {
+			fmt.Println("info string invalid Threads value:", uci.options[id])
+			return
+		}
+		uci.threads = min(max(threads, 1), MaxThreads)
+	case "ownbook":
+		uci.ownBook = strings.EqualFold(uci.options[id], "true")
+	case "bestbookmove":
+		uci.bestBookMove = strings.EqualFold(uci.options[id], "true")
+		uci.open_book.BestMove = uci.bestBookMove
+		switch book := uci.bookFile.(type) {
+		case *PolyglotBook:
+			book.BestMove = uci.bestBookMove
+		case *OpeningBook:
+			book.BestMove = uci.bestBookMove
+		}
+	case "bookfile":
+		uci.loadBookFile(uci.options[id])
+	case "pstfile":
+		path := uci.options[id]
+		if path == "" || path == "<empty>" {
+			SetPieceSquareTables(&DefaultPieceSquareTables)
+		} else if err := LoadPieceSquareTables(path); err != nil {
+			fmt.Println("info string could not load piece-square tables:", err)
+			return
+		}
+		// The sums of the position were made with the old tables
+		uci.pos.middlegame, uci.pos.endgame = uci.pos.ComputeScores()
+	case "kingsafetyfile":
+		path := uci.options[id]
+		if path == "" || path == "<empty>" {
+			KingSafety = DefaultKingSafety
+		} else if err := LoadKingSafetyWeights(path); err != nil {
+			fmt.Println("info string could not load king safety weights:", err)
+		}
+	}
+}
+
+// The book which comes with the engine, it is embedded such that the engine can be started from any directory
+func loadDefaultBook() *OpeningBook {
+	book, err := ReadOpeningBook(bytes.NewReader(resources.BookOpenings))
+	if err != nil {
+		fmt.Println("info string could not load the built in book:", err)
+		return NewOpeningBook()
+	}
+	return book
+}
+
+// The book to play from, nil if the engine should search
+func (uci *UCI) book() Book {
+	switch {
+	case !uci.ownBook:
+		return nil
+	case uci.bookFile != nil:
+		return uci.bookFile
+	default:
+		return uci.open_book
+	}
+}
+
+// loadBookFile loads a Polyglot book, or a book of lines of moves. An empty path goes back to the built in book.
+// When the book can't be loaded, the built in book is kept.
+func (uci *UCI) loadBookFile(path string) {
+	uci.bookFile = nil
+	if path == "" || path == "<empty>" {
+		return
+	}
+
+	if filepath.Ext(path) == ".bin" {
+		book, err := LoadPolyglotBook(path)
+		if err != nil {
+			fmt.Println("info string could not load book:", err)
+			return
+		}
+		book.BestMove = uci.bestBookMove
+		uci.bookFile = book
 		return
 	}
 
-	search := NewSearch(uci.pos)
+	book, err := LoadOpeningBook(path)
+	if err != nil {
+		fmt.Println("info string could not load book:", err)
+		return
+	}
+	book.BestMove = uci.bestBookMove
+	uci.bookFile = book
+}
+
+// The search runs on its own goroutine, such that "stop", "isready" and "quit" are still read while searching.
+func (uci *UCI) startSearch(search *Search) {
+	done := make(chan struct{})
+	uci.search = search
+	uci.searchDone = done
 
-	go search.Search()
-	bestMove := search.BestMove
+	go func() {
+		defer close(done)
+
+		search.Search()
+
+		// When searching infinite, the GUI expects the bestmove only after it has sent "stop",
+		// and when pondering only after "ponderhit" or "stop"
+		for (search.limits.Infinite || search.timer.Pondering()) && !search.timer.Stopped() {
+			time.Sleep(time.Millisecond)
+		}
+
+		printBestMove(search.BestMove, search.PonderMove())
+	}()
+}
 
-	fmt.Println("BestMove: ", bestMove.UCIString())
+// StopSearch stops the running search, and returns once its bestmove has been printed.
+func (uci *UCI) StopSearch() {
+	if uci.search == nil {
+		return
+	}
+
+	uci.search.Stop()
+	<-uci.searchDone
+
+	uci.search = nil
+	uci.searchDone = nil
+}
+
+func printBestMove(move Move, ponder Move) {
+	if move == NilMove() {
+		// No legal moves, the UCI null move is sent
+		fmt.Println("bestmove 0000")
+		return
+	}
+	if ponder != NilMove() {
+		fmt.Println("bestmove", move.UCIString(), "ponder", ponder.UCIString())
+		return
+	}
+	fmt.Println("bestmove", move.UCIString())
 }
 
+// positionCommand handles "position [startpos | fen <fen>] [moves <move1> ... <movei>]".
+// The position is updated in place, as it is shared with the command line interface.
 func (uci *UCI) positionCommand(message string) {
-	msgParts := strings.Split(message, " ")
-	// TODO : make it handle "moves ..""
-	if len(msgParts) < 2 {
-		fmt.Println("Invalid position command")
+	uci.StopSearch()
+
+	fields := strings.Fields(message)
+	if len(fields) < 2 {
+		fmt.Println("info string invalid position command")
 		return
 	}
 
-	// Setu
-	if msgParts[1] == "startpos" {
-		uci.pos = FromStandardStartingPosition()
+	movesIdx := len(fields)
+	for i, field := range fields {
+		if field == "moves" {
+			movesIdx = i
+			break
+		}
+	}
 
-	} else if msgParts[1] == "fen" {
+	var pos *Position
+	switch fields[1] {
+	case "startpos":
+		pos = FromStandardStartingPosition()
+	case "fen":
+		var err error
+		pos, err = FromFEN(strings.Join(fields[2:movesIdx], " "))
+		if err != nil {
+			fmt.Println("info string", err)
+			return
+		}
+	default:
+		// The command line allows the fen without the "fen" keyword
+		var err error
+		pos, err = FromFEN(strings.Join(fields[1:movesIdx], " "))
+		if err != nil {
+			fmt.Println("info string", err)
+			return
+		}
+	}
+
+	// On an illegal move, the position is kept as it was right before it
+	if movesIdx < len(fields) {
+		if err := MakeUCIMoves(pos, fields[movesIdx+1:]); err != nil {
+			fmt.Println("info string", err)
+		}
+	}
+
+	*uci.pos = *pos
+}
+
+// parseGoCommand reads the search limits of a "go" command, e.g. "go wtime 60000 btime 60000 winc 1000 binc 1000"
+func parseGoCommand(message string) (SearchLimits, error) {
+	var limits SearchLimits
+
+	fields := strings.Fields(message)
+	for i := 1; i < len(fields); i++ {
+		switch fields[i] {
+		case "infinite":
+			limits.Infinite = true
+		case "ponder":
+			limits.Ponder = true
+		case "searchmoves":
+			// Not supported, it is followed by moves which are skipped as unknown tokens
+		case "wtime", "btime", "winc", "binc", "movetime", "movestogo", "depth", "nodes", "mate":
+			if i+1 >= len(fields) {
+				return limits, fmt.Errorf("missing value for %s", fields[i])
+			}
+			value, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil {
+				return limits, fmt.Errorf("invalid value for %s: %s", fields[i], fields[i+1])
+			}
+			i++
 
-		fen := strings.Join(msgParts[2:], " ")
-		pos, err := FromFEN(fen)
-		check(err)
-		uci.pos = pos
+			switch fields[i-1] {
+			case "wtime":
+				limits.WTime = value
+			case "btime":
+				limits.BTime = value
+			case "winc":
+				limits.WInc = value
+			case "binc":
+				limits.BInc = value
+			case "movetime":
+				limits.MoveTime = value
+			case "movestogo":
+				limits.MovesToGo = int(value)
+			case "depth":
+				limits.Depth = int(value)
+			case "nodes":
+				limits.Nodes = int(value)
+			case "mate":
+				limits.Mate = int(value)
+			}
+		}
 	}
 
+	return limits, nil
 }
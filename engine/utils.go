@@ -50,7 +50,13 @@ func CastelingRightsToString(rights uint8) string {
 	return castingString
 }
 
-var ErrInvalidMove = errors.New("invalid move")
+// DebugMode enables expensive self-checks, like recomputing the Zobrist key after every move
+var DebugMode = false
+
+var (
+	ErrInvalidMove = errors.New("invalid move")
+	ErrIllegalMove = errors.New("illegal move")
+)
 
 // ParseMove in the form like "e2e4" to a Move struct
 func ParseUCIMove(pos *Position, uciMove string) (Move, error) {
@@ -58,6 +64,12 @@ func ParseUCIMove(pos *Position, uciMove string) (Move, error) {
 		return Move{}, ErrInvalidMove
 	}
 
+	for i := 0; i < 4; i += 2 {
+		if uciMove[i] < 'a' || 'h' < uciMove[i] || uciMove[i+1] < '1' || '8' < uciMove[i+1] {
+			return Move{}, ErrInvalidMove
+		}
+	}
+
 	var move Move
 	from := uciMove[0:2]
 	to := uciMove[2:4]
@@ -69,7 +81,7 @@ func ParseUCIMove(pos *Position, uciMove string) (Move, error) {
 	move.To = Square((to[1]-'0'-1)*8 + toFile)
 
 	if len(uciMove) == 5 {
-		switch uciMove[5] {
+		switch uciMove[4] {
 		case 'q':
 			move.Flag = PromotionToQueen
 		case 'r':
@@ -88,11 +100,27 @@ func ParseUCIMove(pos *Position, uciMove string) (Move, error) {
 	return move, nil
 }
 
+// MakeUCIMoves plays moves like "e2e4 e7e5" on the position, it stops at the first invalid or illegal move.
+func MakeUCIMoves(pos *Position, uciMoves []string) error {
+	for _, uciMove := range uciMoves {
+		move, err := ParseUCIMove(pos, uciMove)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, uciMove)
+		}
+		if !IsMoveValid(pos, move) {
+			return fmt.Errorf("%w: %s", ErrIllegalMove, uciMove)
+		}
+		pos.MakeMove(move)
+	}
+	return nil
+}
+
 // Promotions are handled
 func flagForMove(pos *Position, move Move) MoveFlag {
 	if pos.Board[move.From].PType == Pawn {
 		if pos.Board[move.To].PType == NoPiece {
-			if File(move.To) == pos.EPFile {
+			// Only a diagonal move onto the empty en passant square is a capture
+			if File(move.To) == pos.EPFile && File(move.To) != File(move.From) {
 				return EnPassentCapture
 			}
 			if Rank(move.To) == Rank(move.From)+2 || Rank(move.To) == Rank(move.From)-2 {
@@ -124,7 +152,7 @@ func IsMoveValid(pos *Position, move Move) bool {
 	// Check if the move is valid
 	moveList := LegalMoves(pos)
 	for i := 0; i < len(moveList); i++ {
-		if moveList[i].From == move.From && moveList[i].To == move.To && moveList[i].Flag == moveList[i].Flag {
+		if moveList[i].From == move.From && moveList[i].To == move.To && moveList[i].Flag == move.Flag {
 			return true
 		}
 	}
@@ -135,8 +163,12 @@ func (sq Square) String() string {
 	return fmt.Sprintf("%c%d", FileRune[File(sq)], Rank(sq))
 }
 
+// String is the move in coordinate notation, use Position.SAN for SAN
 func (m Move) String() string {
-	return fmt.Sprintf("From: %d, To: %d, Flag: %d", m.From, m.To, m.Flag)
+	if m == NilMove() {
+		return "0000"
+	}
+	return m.UCIString()
 }
 
 func (m Move) UCIString() string {
@@ -157,9 +189,3 @@ func (m Move) UCIString() string {
 
 	return strbuilder.String()
 }
-
-func check(e error) {
-	if e != nil {
-		panic(e)
-	}
-}
@@ -0,0 +1,98 @@
+package engine
+
+import "fmt"
+
+// Random keys for Zobrist hashing.
+// The key of a position is the XOR of the keys of everything on it, such that it can be updated incrementally.
+var (
+	zobristPieces      [2][6][65]uint64
+	zobristBlackToMove uint64
+	zobristCastling    [16]uint64
+	zobristEPFile      [9]uint64 // Index 0 is no en passant, and has no key
+)
+
+func init() {
+	initZobristKeys()
+}
+
+// xorshift64* with a fixed seed, such that the keys are the same on every run
+type prng struct {
+	state uint64
+}
+
+func (rng *prng) next() uint64 {
+	rng.state ^= rng.state >> 12
+	rng.state ^= rng.state << 25
+	rng.state ^= rng.state >> 27
+	return rng.state * 2685821657736338717
+}
+
+func initZobristKeys() {
+	rng := prng{state: 1070372}
+
+	for color := White; color <= Black; color++ {
+		for ptype := Pawn; ptype <= King; ptype++ {
+			for sq := Square(1); sq <= 64; sq++ {
+				zobristPieces[color][ptype][sq] = rng.next()
+			}
+		}
+	}
+
+	zobristBlackToMove = rng.next()
+
+	for rights := range zobristCastling {
+		zobristCastling[rights] = rng.next()
+	}
+
+	for file := 1; file <= 8; file++ {
+		zobristEPFile[file] = rng.next()
+	}
+}
+
+func zobristPiece(p Piece, sq Square) uint64 {
+	if p.PType == NoPiece {
+		return 0
+	}
+	return zobristPieces[p.Color][p.PType][sq]
+}
+
+// ComputeHash computes the Zobrist key of the position from scratch.
+// The key is kept up to date in MakeMove and UndoMove, so this is only needed when setting up a position.
+func (pos *Position) ComputeHash() uint64 {
+	var hash uint64
+
+	for sq := Square(1); sq <= 64; sq++ {
+		hash ^= zobristPiece(pos.Board[sq], sq)
+	}
+
+	if pos.ColorToMove == Black {
+		hash ^= zobristBlackToMove
+	}
+
+	hash ^= zobristCastling[pos.CastlingRights]
+	hash ^= zobristEPFile[pos.EPFile]
+
+	return hash
+}
+
+// ComputePawnHash computes the key of the pawns alone, it is updated incrementally like the full key
+func (pos *Position) ComputePawnHash() uint64 {
+	var hash uint64
+	for color := White; color <= Black; color++ {
+		pawns := pos.pieceBitboards[color][Pawn]
+		for pawns != 0 {
+			hash ^= zobristPieces[color][Pawn][pawns.Pop()]
+		}
+	}
+	return hash
+}
+
+// Used in debug mode, to catch an incremental update gone wrong as early as possible
+func (pos *Position) checkHash() {
+	if expected := pos.ComputeHash(); pos.Hash != expected {
+		panic(fmt.Sprintf("zobrist key mismatch: %016x, expected %016x, at %s", pos.Hash, expected, FEN(pos)))
+	}
+	if expected := pos.ComputePawnHash(); pos.PawnHash != expected {
+		panic(fmt.Sprintf("pawn key mismatch: %016x, expected %016x, at %s", pos.PawnHash, expected, FEN(pos)))
+	}
+}
@@ -0,0 +1,113 @@
+// Package pgn reads and writes games in Portable Game Notation.
+// Reference: https://www.saremba.de/chessgml/standards/pgn/pgn-complete.htm
+package pgn
+
+import (
+	"tactix/engine"
+)
+
+// Game results, as in the Result tag and at the end of the movetext
+const (
+	WhiteWins = "1-0"
+	BlackWins = "0-1"
+	Draw      = "1/2-1/2"
+	Unknown   = "*"
+)
+
+// The Seven Tag Roster, every game is written with these tags first, in this order
+var SevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// Ply is a move of the game, with its annotations
+type Ply struct {
+	Move engine.Move
+	SAN  string
+
+	CommentBefore string // Only used for comments before the first move of a line
+	Comment       string // Comment after the move
+	NAGs          []int  // Numeric Annotation Glyphs, "!" is read as $1, "?" as $2 and so on
+
+	// Alternatives to this move, each played from the position before it
+	Variations [][]Ply
+}
+
+type Game struct {
+	Tags   []Tag // In the order they were read
+	Plies  []Ply // The main line
+	Result string
+}
+
+// NewGame is an empty game from the standard starting position, with the Seven Tag Roster set to unknown
+func NewGame() *Game {
+	return &Game{
+		Tags: []Tag{
+			{"Event", "?"},
+			{"Site", "?"},
+			{"Date", "????.??.??"},
+			{"Round", "?"},
+			{"White", "?"},
+			{"Black", "?"},
+			{"Result", Unknown},
+		},
+		Result: Unknown,
+	}
+}
+
+// Tag is the value of the tag, or "" if the game doesn't have it
+func (game *Game) Tag(name string) string {
+	for _, tag := range game.Tags {
+		if tag.Name == name {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// SetTag replaces the value of the tag, or adds it at the end
+func (game *Game) SetTag(name, value string) {
+	for i := range game.Tags {
+		if game.Tags[i].Name == name {
+			game.Tags[i].Value = value
+			return
+		}
+	}
+	game.Tags = append(game.Tags, Tag{name, value})
+}
+
+// AddMove appends a move to the main line, the SAN is filled in when the game is written
+func (game *Game) AddMove(move engine.Move) {
+	game.Plies = append(game.Plies, Ply{Move: move})
+}
+
+// StartPosition is the position given by the FEN tag, or the standard starting position
+func (game *Game) StartPosition() (*engine.Position, error) {
+	if fen := game.Tag("FEN"); fen != "" {
+		return engine.FromFEN(fen)
+	}
+	return engine.FromStandardStartingPosition(), nil
+}
+
+// Position is the position at the end of the main line
+func (game *Game) Position() (*engine.Position, error) {
+	pos, err := game.StartPosition()
+	if err != nil {
+		return nil, err
+	}
+	for _, ply := range game.Plies {
+		pos.MakeMove(ply.Move)
+	}
+	return pos, nil
+}
+
+// Moves of the main line
+func (game *Game) Moves() engine.MoveList {
+	moves := make(engine.MoveList, len(game.Plies))
+	for i, ply := range game.Plies {
+		moves[i] = ply.Move
+	}
+	return moves
+}
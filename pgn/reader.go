@@ -0,0 +1,392 @@
+package pgn
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"tactix/engine"
+)
+
+var ErrSyntax = errors.New("pgn syntax error")
+
+// Suffix annotations and the NAGs they stand for
+var suffixNAGs = map[string]int{
+	"!":  1,
+	"?":  2,
+	"!!": 3,
+	"??": 4,
+	"!?": 5,
+	"?!": 6,
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenTag
+	tokenComment
+	tokenOpen  // Start of a variation
+	tokenClose // End of a variation
+	tokenNAG
+	tokenSymbol // Moves, move numbers and results
+)
+
+type token struct {
+	kind  tokenKind
+	text  string // Symbol, comment or tag name
+	value string // Tag value
+}
+
+// Reader streams games from PGN text, one at a time
+type Reader struct {
+	r      *bufio.Reader
+	peeked *token
+	games  int
+
+	lineStart bool // The next byte is in the first column, where % escapes the line
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r), lineStart: true}
+}
+
+// Read the next game, it returns io.EOF when there are no more games.
+// On an illegal move the rest of the game is skipped, such that reading can continue with the next game.
+func (reader *Reader) Read() (*Game, error) {
+	// Skip anything before the tags, like stray results
+	tok, err := reader.peek()
+	for err == nil && tok.kind != tokenEOF && tok.kind != tokenTag && tok.kind != tokenSymbol && tok.kind != tokenComment {
+		reader.next()
+		tok, err = reader.peek()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind == tokenEOF {
+		return nil, io.EOF
+	}
+
+	reader.games++
+	game := &Game{Result: Unknown}
+
+	for tok.kind == tokenTag {
+		reader.next()
+		game.Tags = append(game.Tags, Tag{tok.text, tok.value})
+		if tok, err = reader.peek(); err != nil {
+			return nil, reader.wrap(err)
+		}
+	}
+	if result := game.Tag("Result"); result != "" {
+		game.Result = result
+	}
+
+	pos, err := game.StartPosition()
+	if err != nil {
+		reader.skipGame()
+		return nil, reader.wrap(err)
+	}
+
+	if err := reader.readMovetext(game, pos); err != nil {
+		reader.skipGame()
+		return nil, reader.wrap(err)
+	}
+	return game, nil
+}
+
+func (reader *Reader) wrap(err error) error {
+	return fmt.Errorf("pgn: game %d: %w", reader.games, err)
+}
+
+// A line of play being read, the main line or a variation
+type line struct {
+	plies   *[]Ply
+	pos     *engine.Position
+	comment string // Read before the next move
+}
+
+func (reader *Reader) readMovetext(game *Game, pos *engine.Position) error {
+	lines := []*line{{plies: &game.Plies, pos: pos}}
+
+	for {
+		current := lines[len(lines)-1]
+
+		tok, err := reader.peek()
+		if err != nil {
+			return err
+		}
+
+		switch tok.kind {
+		case tokenEOF, tokenTag:
+			// The game ended without a result
+			if len(lines) > 1 {
+				return fmt.Errorf("%w: unterminated variation", ErrSyntax)
+			}
+			return nil
+		}
+		reader.next()
+
+		switch tok.kind {
+		case tokenComment:
+			plies := *current.plies
+			if len(plies) == 0 || current.comment != "" {
+				current.comment = joinComment(current.comment, tok.text)
+			} else {
+				plies[len(plies)-1].Comment = joinComment(plies[len(plies)-1].Comment, tok.text)
+			}
+
+		case tokenNAG:
+			plies := *current.plies
+			if len(plies) == 0 {
+				return fmt.Errorf("%w: annotation before the first move", ErrSyntax)
+			}
+			nag, _ := strconv.Atoi(tok.text)
+			plies[len(plies)-1].NAGs = append(plies[len(plies)-1].NAGs, nag)
+
+		case tokenOpen:
+			plies := *current.plies
+			if len(plies) == 0 {
+				return fmt.Errorf("%w: variation before the first move", ErrSyntax)
+			}
+			// The variation replaces the last move, so it starts from the position before it
+			last := &plies[len(plies)-1]
+			varPos := current.pos.Copy()
+			varPos.UndoMove(last.Move)
+
+			last.Variations = append(last.Variations, nil)
+			lines = append(lines, &line{plies: &last.Variations[len(last.Variations)-1], pos: varPos})
+
+		case tokenClose:
+			if len(lines) == 1 {
+				return fmt.Errorf("%w: unmatched )", ErrSyntax)
+			}
+			lines = lines[:len(lines)-1]
+
+		case tokenSymbol:
+			switch tok.text {
+			case WhiteWins, BlackWins, Draw, Unknown:
+				if len(lines) > 1 {
+					return fmt.Errorf("%w: result inside a variation", ErrSyntax)
+				}
+				game.Result = tok.text
+				return nil
+			}
+
+			san, nag := splitSuffix(stripMoveNumber(tok.text))
+			if san == "" {
+				// A move number
+				continue
+			}
+
+			move, err := engine.ParseSAN(current.pos, san)
+			if err != nil {
+				return err
+			}
+
+			ply := Ply{Move: move, SAN: current.pos.SAN(move), CommentBefore: current.comment}
+			if nag != 0 {
+				ply.NAGs = append(ply.NAGs, nag)
+			}
+			*current.plies = append(*current.plies, ply)
+			current.comment = ""
+			current.pos.MakeMove(move)
+		}
+	}
+}
+
+// Move numbers like "12." and "12..." may be written right before the move
+func stripMoveNumber(symbol string) string {
+	digits := len(symbol) - len(strings.TrimLeft(symbol, "0123456789"))
+	if digits == len(symbol) {
+		return ""
+	}
+	if digits > 0 && symbol[digits] == '.' {
+		return strings.TrimLeft(symbol[digits:], ".")
+	}
+	return symbol
+}
+
+// Moves may be written with their annotation, like "e4!?"
+func splitSuffix(san string) (string, int) {
+	trimmed := strings.TrimRight(san, "!?")
+	return trimmed, suffixNAGs[san[len(trimmed):]]
+}
+
+func joinComment(comment, text string) string {
+	if comment == "" {
+		return text
+	}
+	return comment + " " + text
+}
+
+// Skips the rest of a game, up to its result or the tags of the next game
+func (reader *Reader) skipGame() {
+	depth := 0
+	for {
+		tok, err := reader.peek()
+		if err != nil || tok.kind == tokenEOF || (tok.kind == tokenTag && depth == 0) {
+			return
+		}
+		reader.next()
+
+		switch tok.kind {
+		case tokenOpen:
+			depth++
+		case tokenClose:
+			depth--
+		case tokenSymbol:
+			switch tok.text {
+			case WhiteWins, BlackWins, Draw, Unknown:
+				if depth <= 0 {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (reader *Reader) peek() (token, error) {
+	if reader.peeked == nil {
+		tok, err := reader.lex()
+		if err != nil {
+			return token{}, err
+		}
+		reader.peeked = &tok
+	}
+	return *reader.peeked, nil
+}
+
+func (reader *Reader) next() (token, error) {
+	tok, err := reader.peek()
+	reader.peeked = nil
+	return tok, err
+}
+
+// lex reads the next token
+func (reader *Reader) lex() (token, error) {
+	for {
+		char, err := reader.r.ReadByte()
+		if err == io.EOF {
+			return token{kind: tokenEOF}, nil
+		}
+		if err != nil {
+			return token{}, err
+		}
+		firstColumn := reader.lineStart
+		reader.lineStart = char == '\n'
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\r' || char == '\n':
+			continue
+		case char == '%' && firstColumn || char == ';':
+			// Escaped lines and rest of line comments, both run up to the end of the line
+			text, err := reader.r.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return token{}, err
+			}
+			reader.lineStart = true
+			if char == '%' {
+				continue
+			}
+			return token{kind: tokenComment, text: strings.TrimSpace(text)}, nil
+		case char == '{':
+			text, err := reader.r.ReadString('}')
+			if err != nil {
+				return token{}, fmt.Errorf("%w: unterminated comment", ErrSyntax)
+			}
+			return token{kind: tokenComment, text: strings.Join(strings.Fields(strings.TrimSuffix(text, "}")), " ")}, nil
+		case char == '[':
+			return reader.lexTag()
+		case char == '(':
+			return token{kind: tokenOpen}, nil
+		case char == ')':
+			return token{kind: tokenClose}, nil
+		case char == '$':
+			digits := reader.readWhile(isDigit)
+			if digits == "" {
+				return token{}, fmt.Errorf("%w: $ without a number", ErrSyntax)
+			}
+			return token{kind: tokenNAG, text: digits}, nil
+		case char == '!' || char == '?':
+			reader.r.UnreadByte()
+			suffix := reader.readWhile(func(c byte) bool { return c == '!' || c == '?' })
+			nag, ok := suffixNAGs[suffix]
+			if !ok {
+				return token{}, fmt.Errorf("%w: unknown annotation %s", ErrSyntax, suffix)
+			}
+			return token{kind: tokenNAG, text: strconv.Itoa(nag)}, nil
+		case isSymbolChar(char):
+			reader.r.UnreadByte()
+			return token{kind: tokenSymbol, text: reader.readWhile(isSymbolChar)}, nil
+		default:
+			return token{}, fmt.Errorf("%w: unexpected character %q", ErrSyntax, char)
+		}
+	}
+}
+
+// lexTag reads `Name "Value"]`, the opening bracket is already read
+func (reader *Reader) lexTag() (token, error) {
+	reader.readWhile(isSpace)
+	name := reader.readWhile(isSymbolChar)
+	reader.readWhile(isSpace)
+
+	if char, err := reader.r.ReadByte(); err != nil || char != '"' || name == "" {
+		return token{}, fmt.Errorf("%w: malformed tag", ErrSyntax)
+	}
+
+	var value strings.Builder
+	for {
+		char, err := reader.r.ReadByte()
+		if err != nil || char == '\n' {
+			return token{}, fmt.Errorf("%w: unterminated tag value", ErrSyntax)
+		}
+		if char == '"' {
+			break
+		}
+		if char == '\\' {
+			if char, err = reader.r.ReadByte(); err != nil {
+				return token{}, fmt.Errorf("%w: unterminated tag value", ErrSyntax)
+			}
+		}
+		value.WriteByte(char)
+	}
+
+	reader.readWhile(isSpace)
+	if char, err := reader.r.ReadByte(); err != nil || char != ']' {
+		return token{}, fmt.Errorf("%w: malformed tag", ErrSyntax)
+	}
+
+	return token{kind: tokenTag, text: name, value: value.String()}, nil
+}
+
+func (reader *Reader) readWhile(accept func(byte) bool) string {
+	var text strings.Builder
+	for {
+		char, err := reader.r.ReadByte()
+		if err != nil {
+			return text.String()
+		}
+		if !accept(char) {
+			reader.r.UnreadByte()
+			return text.String()
+		}
+		text.WriteByte(char)
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// Symbols are moves, move numbers and results. Trailing "!" and "?" belong to the move.
+func isSymbolChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || isDigit(c) ||
+		strings.IndexByte("_+#=:-/.*!?", c) >= 0
+}
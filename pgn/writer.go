@@ -0,0 +1,160 @@
+package pgn
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"tactix/engine"
+)
+
+// Export format lines are kept below 80 characters
+const maxLineLength = 79
+
+// Writer writes games in the PGN export format
+type Writer struct {
+	w     *bufio.Writer
+	games int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write a game, the Seven Tag Roster comes first and missing tags are written as unknown.
+// The SAN of the moves is generated from the moves, such that games built with AddMove can be written.
+func (writer *Writer) Write(game *Game) error {
+	pos, err := game.StartPosition()
+	if err != nil {
+		return err
+	}
+
+	if writer.games > 0 {
+		writer.w.WriteString("\n")
+	}
+	writer.games++
+
+	result := game.Result
+	if result == "" {
+		result = Unknown
+	}
+
+	for _, name := range SevenTagRoster {
+		value := game.Tag(name)
+		switch {
+		case name == "Result":
+			value = result
+		case value == "" && name == "Date":
+			value = "????.??.??"
+		case value == "":
+			value = "?"
+		}
+		writeTag(writer.w, name, value)
+	}
+	for _, tag := range game.Tags {
+		if !slices.Contains(SevenTagRoster, tag.Name) {
+			writeTag(writer.w, tag.Name, tag.Value)
+		}
+	}
+	writer.w.WriteString("\n")
+
+	movetext := &movetextWriter{w: writer.w}
+	movetext.writeLine(pos, game.Plies)
+	movetext.writeToken(result)
+	writer.w.WriteString("\n")
+
+	return writer.w.Flush()
+}
+
+func writeTag(w *bufio.Writer, name, value string) {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	fmt.Fprintf(w, "[%s \"%s\"]\n", name, value)
+}
+
+// movetextWriter wraps the movetext into lines
+type movetextWriter struct {
+	w          *bufio.Writer
+	lineLength int
+	noSpace    bool // Set after an opening parenthesis
+}
+
+func (mw *movetextWriter) writeToken(text string) {
+	space := 1
+	if mw.noSpace {
+		space = 0
+	}
+	if mw.lineLength > 0 && mw.lineLength+space+len(text) > maxLineLength {
+		mw.w.WriteString("\n")
+		mw.lineLength = 0
+	}
+	if mw.lineLength > 0 && space > 0 {
+		mw.w.WriteString(" ")
+		mw.lineLength++
+	}
+	mw.noSpace = false
+	mw.w.WriteString(text)
+	mw.lineLength += len(text)
+}
+
+func (mw *movetextWriter) writeComment(comment string) {
+	// Comments are split into words, such that long comments are wrapped too
+	words := strings.Fields(comment)
+	for i, word := range words {
+		if i == 0 {
+			word = "{" + word
+		}
+		if i == len(words)-1 {
+			word += "}"
+		}
+		mw.writeToken(word)
+	}
+}
+
+// writeLine writes the plies played from the position, the position is left as it was
+func (mw *movetextWriter) writeLine(pos *engine.Position, plies []Ply) {
+	// Black's move number is written at the start of a line, and after anything that interrupts the moves
+	needsNumber := true
+
+	for _, ply := range plies {
+		if ply.CommentBefore != "" {
+			mw.writeComment(ply.CommentBefore)
+			needsNumber = true
+		}
+
+		// The move number is kept on the same line as its move
+		san := pos.SAN(ply.Move)
+		if pos.ColorToMove == engine.White {
+			san = fmt.Sprintf("%d. %s", pos.Ply, san)
+		} else if needsNumber {
+			san = fmt.Sprintf("%d... %s", pos.Ply, san)
+		}
+		needsNumber = false
+
+		mw.writeToken(san)
+		for _, nag := range ply.NAGs {
+			mw.writeToken(fmt.Sprintf("$%d", nag))
+		}
+		if ply.Comment != "" {
+			mw.writeComment(ply.Comment)
+			needsNumber = true
+		}
+
+		for _, variation := range ply.Variations {
+			mw.writeToken("(")
+			mw.noSpace = true
+			mw.writeLine(pos, variation)
+			mw.noSpace = true
+			mw.writeToken(")")
+			needsNumber = true
+		}
+
+		pos.MakeMove(ply.Move)
+	}
+
+	for i := len(plies) - 1; i >= 0; i-- {
+		pos.UndoMove(plies[i].Move)
+	}
+}
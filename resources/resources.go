@@ -0,0 +1,9 @@
+// Package resources embeds the data files of the engine, such that it runs from any directory.
+package resources
+
+import _ "embed"
+
+// The default opening book, lines of moves played from the starting position
+//
+//go:embed book_openings.txt
+var BookOpenings []byte
@@ -0,0 +1,171 @@
+package engine_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"tactix/book"
+	"tactix/engine"
+	"testing"
+)
+
+const bookGames = `[WhiteElo "2500"]
+[BlackElo "2400"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+
+[WhiteElo "2500"]
+[BlackElo "2400"]
+[Result "1/2-1/2"]
+
+1. e4 e5 2. Nf3 Nf6 1/2-1/2
+
+[WhiteElo "1500"]
+[BlackElo "2400"]
+[Result "0-1"]
+
+1. d4 d5 0-1
+
+[Result "*"]
+
+1. c4 *
+
+[Result "1-0"]
+
+1. e4 Qh4 2. Qh5 Qxh5 3. Bxh5 Kd8 4. Bxf7 Kx7 1-0
+`
+
+func TestBookBuilder(t *testing.T) {
+	options := book.DefaultOptions()
+	options.Depth = 4
+	options.MinGames = 2
+	options.MinElo = 2000
+
+	builder := book.NewBuilder(options)
+	errs := builder.AddGames(strings.NewReader(bookGames))
+	if len(errs) != 1 {
+		t.Errorf("expected the broken game to be reported, got %v", errs)
+	}
+	if builder.Games != 2 || builder.Skipped != 2 {
+		t.Errorf("expected 2 games added and 2 left out, got %d and %d", builder.Games, builder.Skipped)
+	}
+
+	openingBook := builder.Book()
+	pos := engine.FromStandardStartingPosition()
+	moves := openingBook.Moves(pos)
+	if len(moves) != 1 || pos.SAN(moves[0].Move) != "e4" {
+		t.Fatalf("expected only e4, got %v", moves)
+	}
+	// Won once and drawn once by White
+	if moves[0].Count != 2 || moves[0].Weight != 3 {
+		t.Errorf("expected e4 with count 2 and weight 3, got %+v", moves[0])
+	}
+
+	// Nc6 and Nf6 were played once each
+	if err := engine.MakeMoves(pos, []string{"e4", "e5", "Nf3"}); err != nil {
+		t.Fatal(err)
+	}
+	if moves := openingBook.Moves(pos); len(moves) != 0 {
+		t.Errorf("expected the moves played once to be left out, got %v", moves)
+	}
+}
+
+func TestBookLinesRoundTrip(t *testing.T) {
+	original, err := engine.ReadOpeningBook(strings.NewReader(testBookLines))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := original.WriteLines(&buf); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.String()
+
+	book, err := engine.ReadOpeningBook(&buf)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, written)
+	}
+	if book.Positions() != original.Positions() {
+		t.Errorf("expected %d positions, got %d:\n%s", original.Positions(), book.Positions(), written)
+	}
+}
+
+func TestBookLinesKeepWeights(t *testing.T) {
+	options := book.DefaultOptions()
+	options.Depth = 4
+	builder := book.NewBuilder(options)
+	builder.AddGames(strings.NewReader(bookGames))
+	built := builder.Book()
+
+	var buf bytes.Buffer
+	if err := built.WriteLines(&buf); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.String()
+	read, err := engine.ReadOpeningBook(&buf)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, written)
+	}
+
+	// 1. e4 was won once and drawn once, 1. d4 was lost and has no weight
+	pos := engine.FromStandardStartingPosition()
+	for _, line := range [][]string{{}, {"e4"}, {"e4", "e5"}, {"e4", "e5", "Nf3"}, {"d4"}} {
+		pos := pos.Copy()
+		if err := engine.MakeMoves(pos, line); err != nil {
+			t.Fatal(err)
+		}
+		expected := built.Moves(pos)
+		weights := make(map[engine.Move]int)
+		for _, move := range read.Moves(pos) {
+			weights[move.Move] = move.Weight
+		}
+		if len(weights) != len(expected) {
+			t.Errorf("%v: expected %v, got %v\n%s", line, expected, read.Moves(pos), written)
+		}
+		for _, move := range expected {
+			if weight, ok := weights[move.Move]; !ok || weight != move.Weight {
+				t.Errorf("%v: expected %s with weight %d, got %v\n%s", line, move.Move.UCIString(), move.Weight, read.Moves(pos), written)
+			}
+		}
+	}
+}
+
+func TestBookPolyglotRoundTrip(t *testing.T) {
+	original, err := engine.ReadOpeningBook(strings.NewReader(testBookLines))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := original.PolyglotEntries()
+	if errors.Is(err, engine.ErrPolyglotKeysMissing) {
+		t.Skip("the Random64 key table is not in the tree")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := engine.WritePolyglotBook(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	polyglot, err := engine.ReadPolyglotBook(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := engine.FromStandardStartingPosition()
+	expected, moves := original.Moves(pos), polyglot.Moves(pos)
+	if len(moves) == 0 || len(moves) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, moves)
+	}
+	weights := make(map[engine.Move]int)
+	for _, move := range moves {
+		weights[move.Move] = move.Weight
+	}
+	for _, move := range expected {
+		if weight, ok := weights[move.Move]; !ok || weight != move.Weight {
+			t.Errorf("expected %+v, got %v", move, moves)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package engine_test
+
+import (
+	"bytes"
+	"strings"
+	"tactix/engine"
+	"testing"
+)
+
+// mirrorFEN flips the board vertically and swaps the colours, the mirrored position is as good for the other side
+func mirrorFEN(fen string) string {
+	fields := strings.Fields(fen)
+
+	ranks := strings.Split(fields[0], "/")
+	for i, j := 0, len(ranks)-1; i < j; i, j = i+1, j-1 {
+		ranks[i], ranks[j] = ranks[j], ranks[i]
+	}
+	fields[0] = swapCase(strings.Join(ranks, "/"))
+
+	if fields[1] == "w" {
+		fields[1] = "b"
+	} else {
+		fields[1] = "w"
+	}
+	if fields[2] != "-" {
+		fields[2] = swapCase(fields[2])
+	}
+	if fields[3] != "-" {
+		fields[3] = fields[3][:1] + map[byte]string{'3': "6", '6': "3"}[fields[3][1]]
+	}
+	return strings.Join(fields, " ")
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'a' <= r && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if 'A' <= r && r <= 'Z' {
+			return r - 'A' + 'a'
+		}
+		return r
+	}, s)
+}
+
+func TestEvaluateSymmetry(t *testing.T) {
+	fens := []string{
+		kiwipeteFEN,
+		"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3",
+		"8/5k2/8/3P4/8/8/2K5/8 w - - 0 1",
+		"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1",
+	}
+
+	for _, fen := range fens {
+		pos, err := engine.FromFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mirrored, err := engine.FromFEN(mirrorFEN(fen))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if eval, mirroredEval := engine.EvaluateWhite(pos), engine.EvaluateWhite(mirrored); eval != -mirroredEval {
+			t.Errorf("%s: %d, but the mirrored position is %d", fen, eval, mirroredEval)
+		}
+		// For the side to move both positions are the same
+		if eval, mirroredEval := engine.Evaluate(pos), engine.Evaluate(mirrored); eval != mirroredEval {
+			t.Errorf("%s: %d for the side to move, but the mirrored position is %d", fen, eval, mirroredEval)
+		}
+	}
+
+	if eval := engine.EvaluateWhite(engine.FromStandardStartingPosition()); eval != 0 {
+		t.Errorf("expected the starting position to be equal, got %d", eval)
+	}
+}
+
+func TestTaperedKingPlacement(t *testing.T) {
+	// With only pawns left the king belongs in the centre
+	corner, _ := engine.FromFEN("7k/8/8/8/8/8/PPP5/K7 w - - 0 1")
+	centre, _ := engine.FromFEN("7k/8/8/8/3K4/8/PPP5/8 w - - 0 1")
+	if engine.EvaluateWhite(centre) <= engine.EvaluateWhite(corner) {
+		t.Errorf("expected the centralized king to be better in the endgame")
+	}
+
+	// With all pieces on the board it belongs in the corner, behind its pawns
+	castled, _ := engine.FromFEN("rnbq1rk1/pppppppp/8/8/8/8/PPPPPPPP/RNBQ1RK1 w - - 0 1")
+	centred, _ := engine.FromFEN("rnbq1rk1/pppppppp/8/8/8/8/PPPPPPPP/RNBQKR2 w - - 0 1")
+	if engine.EvaluateWhite(centred) >= engine.EvaluateWhite(castled) {
+		t.Errorf("expected the castled king to be better in the middlegame")
+	}
+}
+
+func TestPieceSquareTablesFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := engine.DefaultPieceSquareTables.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := engine.ReadPieceSquareTables(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *tables != engine.DefaultPieceSquareTables {
+		t.Error("expected the tables to be read back as written")
+	}
+
+	// Tables left out keep their default values
+	tables, err = engine.ReadPieceSquareTables(strings.NewReader("# Knights on the rim\nknight endgame\n" + strings.Repeat("7 ", 64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables.Endgame[engine.Knight][0] != 7 || tables.Middlegame[engine.Knight] != engine.DefaultPieceSquareTables.Middlegame[engine.Knight] {
+		t.Error("expected only the knight endgame table to change")
+	}
+
+	if _, err := engine.ReadPieceSquareTables(strings.NewReader("pawn middlegame\n1 2 3\n")); err == nil {
+		t.Error("expected an error for a short table")
+	}
+	if _, err := engine.ReadPieceSquareTables(strings.NewReader("dragon middlegame\n")); err == nil {
+		t.Error("expected an error for an unknown table")
+	}
+}
+
+func TestEvaluatePerspective(t *testing.T) {
+	// White is a queen up, which is good for White and bad for Black when it is Black's move
+	pos, _ := engine.FromFEN("4k3/8/8/8/8/8/8/3QK3 b - - 0 1")
+	if eval := engine.EvaluateWhite(pos); eval <= 0 {
+		t.Errorf("expected a positive score for White, got %d", eval)
+	}
+	if eval := engine.Evaluate(pos); eval >= 0 {
+		t.Errorf("expected a negative score for Black to move, got %d", eval)
+	}
+}
+
+func TestIncrementalEvaluation(t *testing.T) {
+	fens := []string{
+		kiwipeteFEN,
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+
+	// Every position reached by MakeMove and UndoMove evaluates as the same position set up from its FEN
+	var walk func(pos *engine.Position, depth int)
+	walk = func(pos *engine.Position, depth int) {
+		fresh, err := engine.FromFEN(engine.FEN(pos))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if eval, expected := engine.Evaluate(pos), engine.Evaluate(fresh); eval != expected {
+			t.Fatalf("%s: incremental evaluation %d, expected %d", engine.FEN(pos), eval, expected)
+		}
+		if depth == 0 {
+			return
+		}
+		for _, move := range engine.LegalMoves(pos) {
+			pos.MakeMove(move)
+			walk(pos, depth-1)
+			pos.UndoMove(move)
+		}
+	}
+
+	for _, fen := range fens {
+		pos, err := engine.FromFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		walk(pos, 2)
+	}
+}
+
+func TestEvaluateDoesNotAllocate(t *testing.T) {
+	pos, _ := engine.FromFEN(kiwipeteFEN)
+	if allocs := testing.AllocsPerRun(100, func() { engine.Evaluate(pos) }); allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func BenchmarkEvaluate(b *testing.B) {
+	pos, _ := engine.FromFEN(kiwipeteFEN)
+	for i := 0; i < b.N; i++ {
+		engine.Evaluate(pos)
+	}
+}
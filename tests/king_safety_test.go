@@ -0,0 +1,77 @@
+package engine_test
+
+import (
+	"bytes"
+	"strings"
+	"tactix/engine"
+	"testing"
+)
+
+func TestKingSafety(t *testing.T) {
+	// The positions only differ around White's king, the king safety has to widen the gap between them
+	tests := []struct {
+		name       string
+		safe, weak string
+	}{
+		{"pawn shield", "r1bq1rk1/pppp1ppp/2n2n2/2b1p3/2B1P3/2NP1N2/PPP2PPP/R1BQ1RK1 w - - 0 1", "r1bq1rk1/pppp1ppp/2n2n2/2b1p3/2B1P3/2NP1NP1/PPP2P1P/R1BQ1RK1 w - - 0 1"},
+		{"half open file", "r1bq1rk1/pppp1ppp/2n2n2/2b1p3/2B1P3/2NP1N2/PPP2PPP/R1BQ1RK1 w - - 0 1", "r1bq1rk1/pppp1ppp/2n5/2b1p3/2B1P3/2NP1P2/PPP2P1P/R1BQ1RK1 w - - 0 1"},
+		{"attackers", "r1b2rk1/pppq1ppp/2nb1n2/4p3/4P3/2NP1N2/PPP2PPP/R1BQ1RK1 w - - 0 1", "r1b2rk1/ppp2ppp/2nb4/4p3/4P1nq/2NP1N2/PPP2PPP/R1BQ1RK1 w - - 0 1"},
+	}
+
+	gap := func(test struct{ name, safe, weak string }) int {
+		safe, err := engine.FromFEN(test.safe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		weak, err := engine.FromFEN(test.weak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return engine.EvaluateWhite(safe) - engine.EvaluateWhite(weak)
+	}
+
+	defer func() { engine.KingSafety = engine.DefaultKingSafety }()
+	for _, test := range tests {
+		engine.KingSafety = engine.KingSafetyWeights{}
+		without := gap(test)
+		engine.KingSafety = engine.DefaultKingSafety
+		with := gap(test)
+
+		if with <= without {
+			t.Errorf("%s: expected the king safety to favour the safe king, the gap is %d with it and %d without", test.name, with, without)
+		}
+	}
+}
+
+func TestKingSafetyFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := engine.DefaultKingSafety.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	weights, err := engine.ReadKingSafetyWeights(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *weights != engine.DefaultKingSafety {
+		t.Error("expected the weights to be read back as written")
+	}
+
+	// Weights left out keep their default values
+	weights, err = engine.ReadKingSafetyWeights(strings.NewReader("# No open files\nopen file\n0\nshield pawn\n20 10\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := engine.DefaultKingSafety
+	expected.OpenFile = 0
+	expected.ShieldPawn = [2]int{20, 10}
+	if *weights != expected {
+		t.Errorf("expected only the open file and shield pawn weights to change, got %+v", weights)
+	}
+
+	if _, err := engine.ReadKingSafetyWeights(strings.NewReader("danger\n1 2 3\n")); err == nil {
+		t.Error("expected an error for a short danger table")
+	}
+	if _, err := engine.ReadKingSafetyWeights(strings.NewReader("moat depth\n3\n")); err == nil {
+		t.Error("expected an error for unknown weights")
+	}
+}
@@ -2,6 +2,7 @@ package engine_test
 
 import (
 	"fmt"
+	"sync"
 	"tactix/engine"
 	"testing"
 )
@@ -21,3 +22,82 @@ func TestPerftSuite(t *testing.T) {
 		}
 	}
 }
+
+const kiwipeteFEN = "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+func BenchmarkPerft(b *testing.B) {
+	pos, err := engine.FromFEN(kiwipeteFEN)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		engine.Perft(pos, 3)
+	}
+}
+
+func BenchmarkGenerateLegalMoves(b *testing.B) {
+	pos, err := engine.FromFEN(kiwipeteFEN)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buffer engine.MoveBuffer
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		engine.GenerateLegalMoves(pos, &buffer)
+	}
+}
+
+func TestMovegenDoesNotAllocate(t *testing.T) {
+	pos, err := engine.FromFEN(kiwipeteFEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer engine.MoveBuffer
+
+	if allocs := testing.AllocsPerRun(100, func() { engine.GenerateLegalMoves(pos, &buffer) }); allocs != 0 {
+		t.Errorf("GenerateLegalMoves: %v allocations", allocs)
+	}
+	if allocs := testing.AllocsPerRun(10, func() { engine.Perft(pos, 2) }); allocs != 0 {
+		t.Errorf("Perft: %v allocations", allocs)
+	}
+}
+
+// Move generation keeps no shared state, run with -race to check it
+func TestConcurrentPerft(t *testing.T) {
+	tests := engine.PerftSuite[:8]
+
+	// The counts are taken one position at a time first, such that a bug in shared state can't change them too
+	expected := make([]int, len(tests))
+	for i, perftTest := range tests {
+		pos, err := engine.FromFEN(perftTest.FEN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[i] = engine.Perft(pos, min(perftTest.Depth, 3))
+	}
+
+	var wg sync.WaitGroup
+	for i, perftTest := range tests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pos, err := engine.FromFEN(perftTest.FEN)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			depth := min(perftTest.Depth, 3)
+			for j := 0; j < 3; j++ {
+				if nodes := engine.Perft(pos, depth); nodes != expected[i] {
+					t.Errorf("position %d: %d nodes (expected %d)", i, nodes, expected[i])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
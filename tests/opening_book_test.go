@@ -0,0 +1,86 @@
+package engine_test
+
+import (
+	"bytes"
+	"strings"
+	"tactix/engine"
+	"tactix/resources"
+	"testing"
+)
+
+const testBookLines = `# Queen's pawn lines
+d2d4 d7d5 g1f3 g8f6
+g1f3 d7d5 d2d4 c8f5
+d2d4 d7d5 c2c4
+`
+
+func TestOpeningBookTranspositions(t *testing.T) {
+	book, err := engine.ReadOpeningBook(strings.NewReader(testBookLines))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1.Nf3 d5 2.d4 reaches the position of 1.d4 d5 2.Nf3, so both black replies are found
+	pos := engine.FromStandardStartingPosition()
+	if err := engine.MakeMoves(pos, []string{"Nf3", "d5", "d4"}); err != nil {
+		t.Fatal(err)
+	}
+	moves := book.Moves(pos)
+	if len(moves) != 2 {
+		t.Fatalf("expected 2 book moves, got %v", moves)
+	}
+
+	pos = engine.FromStandardStartingPosition()
+	if err := engine.MakeMoves(pos, []string{"d4"}); err != nil {
+		t.Fatal(err)
+	}
+	moves = book.Moves(pos)
+	if len(moves) != 1 || moves[0].Count != 2 || moves[0].Weight != 2 {
+		t.Errorf("expected d5 played twice, got %v", moves)
+	}
+}
+
+func TestOpeningBookFromFEN(t *testing.T) {
+	book, err := engine.ReadOpeningBook(strings.NewReader(testBookLines))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The position after 1.d4 d5, set up without a move history
+	pos, err := engine.FromFEN("rnbqkbnr/ppp1pppp/8/3p4/3P4/8/PPP1PPPP/RNBQKBNR w KQkq d6 0 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	book.BestMove = true
+	move, ok := book.Move(pos)
+	if !ok {
+		t.Fatal("expected the position to be in the book")
+	}
+	if san := pos.SAN(move); san != "Nf3" && san != "c4" {
+		t.Errorf("expected Nf3 or c4, got %s", san)
+	}
+
+	pos.MakeMove(move)
+	pos.MakeMove(engine.LegalMoves(pos)[0])
+	if _, ok := book.Move(pos); ok {
+		t.Error("expected the position to be out of book")
+	}
+}
+
+func TestOpeningBookIllegalLine(t *testing.T) {
+	if _, err := engine.ReadOpeningBook(strings.NewReader("e2e4 e7e5\ne2e4 e5d6\n")); err == nil {
+		t.Error("expected an error for an illegal move")
+	}
+}
+
+func TestEmbeddedOpeningBook(t *testing.T) {
+	// The tests run in another directory than the resources, the book has to be embedded
+	book, err := engine.ReadOpeningBook(bytes.NewReader(resources.BookOpenings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := book.Move(engine.FromStandardStartingPosition()); !ok {
+		t.Error("expected a book move in the starting position")
+	}
+}
@@ -0,0 +1,60 @@
+package engine_test
+
+import (
+	"tactix/engine"
+	"testing"
+)
+
+func TestPawnStructure(t *testing.T) {
+	// With only kings and pawns the piece-square tables score each rank the same on every file,
+	// so the structure of the pawns makes the difference
+	tests := []struct {
+		name          string
+		better, worse string
+	}{
+		{"connected over isolated", "4k3/pppppp2/8/8/8/8/PPP5/4K3 w - - 0 1", "4k3/pppppp2/8/8/8/8/P1P1P3/4K3 w - - 0 1"},
+		{"passed over blocked", "4k3/p7/4P3/8/8/8/8/4K3 w - - 0 1", "4k3/4p3/4P3/8/8/8/8/4K3 w - - 0 1"},
+		{"healthy over doubled", "4k3/pppppppp/8/8/8/2P5/1P6/4K3 w - - 0 1", "4k3/pppppppp/8/8/8/2P5/2P5/4K3 w - - 0 1"},
+	}
+
+	for _, test := range tests {
+		better, err := engine.FromFEN(test.better)
+		if err != nil {
+			t.Fatal(err)
+		}
+		worse, err := engine.FromFEN(test.worse)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if engine.EvaluateWhite(better) <= engine.EvaluateWhite(worse) {
+			t.Errorf("%s: expected %d to be more than %d", test.name, engine.EvaluateWhite(better), engine.EvaluateWhite(worse))
+		}
+	}
+}
+
+func TestPawnHashIsIncremental(t *testing.T) {
+	pos, err := engine.FromFEN("n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var walk func(depth int)
+	walk = func(depth int) {
+		if pos.PawnHash != pos.ComputePawnHash() {
+			t.Fatalf("%s: incremental pawn key %016x, expected %016x", engine.FEN(pos), pos.PawnHash, pos.ComputePawnHash())
+		}
+		if depth == 0 {
+			return
+		}
+		for _, move := range engine.LegalMoves(pos) {
+			before := pos.PawnHash
+			pos.MakeMove(move)
+			walk(depth - 1)
+			pos.UndoMove(move)
+			if pos.PawnHash != before {
+				t.Fatalf("%s: the pawn key was not restored after %s", engine.FEN(pos), move)
+			}
+		}
+	}
+	walk(3)
+}
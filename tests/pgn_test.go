@@ -0,0 +1,238 @@
+package engine_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"tactix/engine"
+	"tactix/pgn"
+	"testing"
+)
+
+const testPGN = `[Event "Casual game"]
+[Site "Berlin GER"]
+[Date "1852.??.??"]
+[Round "?"]
+[White "Anderssen, Adolf"]
+[Black "Dufresne, Jean"]
+[Result "1-0"]
+
+{The Evergreen Game} 1.e4 e5 2.Nf3 Nc6 3.Bc4 Bc5 4.b4 Bxb4 5.c3 Ba5 6.d4 exd4
+7.O-O d3 8.Qb3 Qf6 9.e5 Qg6 10.Re1 Nge7 11.Ba3 b5 12.Qxb5 Rb8 13.Qa4 Bb6
+14.Nbd2 Bb7 15.Ne4 Qf5 16.Bxd3 Qh5 17.Nf6+ gxf6 18.exf6 Rg8 19.Rad1! Qxf3
+20.Rxe7+ Nxe7 (20...Kd8 21.Rxd7+ (21.Rxf7 Ke8) Kc8 22.Rd8+ Kxd8) 21.Qxd7+ $1
+Kxd7 22.Bf5+ Ke8 23.Bd7+ Kf8 24.Bxe7# 1-0
+
+[Event "Broken"]
+[Result "*"]
+
+1. e4 e5 2. Ke3 Nc6 *
+
+[Event "No result"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+[SetUp "1"]
+
+1. e4 Kd7 ; a comment to the end of the line
+2. e5!? Ke6 3. Ke2 Kxe5
+`
+
+func TestPGNReader(t *testing.T) {
+	reader := pgn.NewReader(strings.NewReader(testPGN))
+
+	game, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Tag("White") != "Anderssen, Adolf" || game.Result != pgn.WhiteWins {
+		t.Errorf("wrong tags %v", game.Tags)
+	}
+	if len(game.Plies) != 47 {
+		t.Errorf("expected 47 plies, got %d", len(game.Plies))
+	}
+	if game.Plies[0].CommentBefore != "The Evergreen Game" {
+		t.Errorf("wrong comment %q", game.Plies[0].CommentBefore)
+	}
+	if nags := game.Plies[36].NAGs; len(nags) != 1 || nags[0] != 1 {
+		t.Errorf("expected $1 on Rad1, got %v", nags)
+	}
+
+	// 20...Nxe7 has a variation, with a variation of its own
+	variations := game.Plies[39].Variations
+	if len(variations) != 1 || len(variations[0]) != 5 || variations[0][1].SAN != "Rxd7+" {
+		t.Fatalf("wrong variation %v", variations)
+	}
+	if nested := variations[0][1].Variations; len(nested) != 1 || nested[0][0].SAN != "Rxf7" {
+		t.Errorf("wrong nested variation %v", nested)
+	}
+
+	pos, err := game.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.GameResult() != engine.WhiteWins {
+		t.Errorf("expected checkmate, got %s", pos.GameResult())
+	}
+
+	// The illegal king move is reported, and the game skipped
+	if _, err := reader.Read(); !errors.Is(err, engine.ErrIllegalMove) {
+		t.Errorf("expected an illegal move, got %v", err)
+	}
+
+	game, err = reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Result != pgn.Unknown || len(game.Plies) != 6 {
+		t.Errorf("expected 6 plies without a result, got %d plies and %s", len(game.Plies), game.Result)
+	}
+	if game.Plies[1].Comment != "a comment to the end of the line" {
+		t.Errorf("wrong comment %q", game.Plies[1].Comment)
+	}
+	if nags := game.Plies[2].NAGs; len(nags) != 1 || nags[0] != 5 {
+		t.Errorf("expected !? as $5, got %v", nags)
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+// Writing the games and reading them back gives the same text again
+func TestPGNWriterRoundTrip(t *testing.T) {
+	var games []*pgn.Game
+	reader := pgn.NewReader(strings.NewReader(testPGN))
+	for {
+		game, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			games = append(games, game)
+		}
+	}
+
+	var first bytes.Buffer
+	writer := pgn.NewWriter(&first)
+	for _, game := range games {
+		if err := writer.Write(game); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !strings.Contains(strings.Join(strings.Fields(first.String()), " "), "20. Rxe7+ Nxe7 (20... Kd8 21. Rxd7+ (21. Rxf7 Ke8) 21... Kc8 22. Rd8+ Kxd8)") {
+		t.Errorf("variations written wrong:\n%s", first.String())
+	}
+	for _, line := range strings.Split(first.String(), "\n") {
+		if len(line) >= 80 {
+			t.Errorf("line too long: %s", line)
+		}
+	}
+
+	// Reading the buffer empties it
+	written := first.String()
+
+	var second bytes.Buffer
+	writer = pgn.NewWriter(&second)
+	reader = pgn.NewReader(&first)
+	for {
+		game, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write(game)
+	}
+
+	if second.String() != written {
+		t.Errorf("expected\n%s\ngot\n%s", written, second.String())
+	}
+}
+
+func TestPGNWriterSevenTagRoster(t *testing.T) {
+	game := pgn.NewGame()
+	game.SetTag("White", "Tactix")
+	game.SetTag("Annotator", "Tactix")
+	game.Result = pgn.Draw
+
+	pos := engine.FromStandardStartingPosition()
+	for _, san := range []string{"e4", "e5", "Qh5", "Ke7", "Qxe5#"} {
+		move, err := engine.ParseSAN(pos, san)
+		if err != nil {
+			t.Fatal(err)
+		}
+		game.AddMove(move)
+		pos.MakeMove(move)
+	}
+
+	var out bytes.Buffer
+	if err := pgn.NewWriter(&out).Write(game); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[Event "?"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "Tactix"]
+[Black "?"]
+[Result "1/2-1/2"]
+[Annotator "Tactix"]
+
+1. e4 e5 2. Qh5 Ke7 3. Qxe5# 1/2-1/2
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+// A % only escapes a line in the first column
+func TestPGNEscapedLines(t *testing.T) {
+	reader := pgn.NewReader(strings.NewReader("% escaped [Event \"Hidden\"]\n[Result \"*\"]\n\n1. e4 e5\n% 2. Ke2\n2. Nf3 *\n"))
+	game, err := reader.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Tag("Event") != "" || len(game.Plies) != 3 {
+		t.Errorf("expected the escaped lines to be skipped, got %v and %d plies", game.Tags, len(game.Plies))
+	}
+
+	reader = pgn.NewReader(strings.NewReader("[Result \"*\"]\n\n1. e4 % e5 *\n"))
+	if _, err := reader.Read(); !errors.Is(err, pgn.ErrSyntax) {
+		t.Errorf("expected a syntax error for %% inside a line, got %v", err)
+	}
+}
+
+// Closing parentheses are wrapped like any other token
+func TestPGNWriterWrapsVariations(t *testing.T) {
+	// Knights going back and forth, every move with the other knight's move as a variation.
+	// The comment shifts the moves such that a variation ends in the last column, after its annotation.
+	game := pgn.NewGame()
+	pos := engine.FromStandardStartingPosition()
+	knights := [][2]string{{"Nf3", "Nc3"}, {"Nf6", "Nc6"}, {"Ng1", "Nh4"}, {"Ng8", "Nh5"}}
+	for i := 0; i < 8; i++ {
+		main, err := engine.ParseSAN(pos, knights[i%4][0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		side, err := engine.ParseSAN(pos, knights[i%4][1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		game.Plies = append(game.Plies, pgn.Ply{Move: main, Variations: [][]pgn.Ply{{{Move: side, NAGs: []int{1}}}}})
+		pos.MakeMove(main)
+	}
+	game.Plies[0].CommentBefore = strings.Repeat("x", 17)
+
+	var buf bytes.Buffer
+	if err := pgn.NewWriter(&buf).Write(game); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if len(line) >= 80 {
+			t.Errorf("line too long: %s", line)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package engine_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"tactix/engine"
+	"testing"
+)
+
+func TestPolyglotMoveEncoding(t *testing.T) {
+	fens := []string{
+		engine.StartingPositionFEN,
+		kiwipeteFEN,
+		"2n1k3/1P6/8/8/8/8/8/4K3 w - - 0 1",
+		"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1",
+	}
+
+	for _, fen := range fens {
+		pos, err := engine.FromFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, move := range engine.LegalMoves(pos) {
+			decoded, ok := engine.DecodePolyglotMove(pos, engine.EncodePolyglotMove(move))
+			if !ok || decoded != move {
+				t.Errorf("%s: %v decoded as %v", fen, move, decoded)
+			}
+		}
+	}
+}
+
+func TestPolyglotCastlingEncoding(t *testing.T) {
+	pos, _ := engine.FromFEN("4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1")
+	move, _ := engine.ParseMove(pos, "e1g1")
+
+	// The king captures its rook, e1h1
+	if got := engine.EncodePolyglotMove(move); got != 4<<6|7 {
+		t.Errorf("expected e1h1, got %#x", got)
+	}
+}
+
+func TestPolyglotKeys(t *testing.T) {
+	var buf bytes.Buffer
+	if err := engine.WritePolyglotBook(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.ReadPolyglotBook(&buf); errors.Is(err, engine.ErrPolyglotKeysMissing) {
+		t.Skip("the Random64 key table is not in the tree")
+	}
+
+	// Key vectors from the book format specification
+	tests := []struct {
+		moves string
+		key   uint64
+	}{
+		{"", 0x463b96181691fc9c},
+		{"e2e4", 0x823c9b50fd114196},
+		{"e2e4 d7d5", 0x0756b94461c50fb0},
+		{"e2e4 d7d5 e4e5", 0x662fafb965db29d4},
+		{"e2e4 d7d5 e4e5 f7f5", 0x22a48b5a8e47ff78},
+		{"e2e4 d7d5 e4e5 f7f5 e1e2", 0x652a607ca3f242c1},
+		{"e2e4 d7d5 e4e5 f7f5 e1e2 e8f7", 0x00fdd303c946bdd9},
+		{"a2a4 b7b5 h2h4 b5b4 c2c4", 0x3c8123ea7b067637},
+		{"a2a4 b7b5 h2h4 b5b4 c2c4 b4c3 a1a3", 0x5c3f9b829b279560},
+	}
+
+	for _, test := range tests {
+		pos := engine.FromStandardStartingPosition()
+		if err := engine.MakeMoves(pos, strings.Fields(test.moves)); err != nil {
+			t.Fatal(err)
+		}
+		if key := engine.PolyglotKey(pos); key != test.key {
+			t.Errorf("%q: expected %#x, got %#x", test.moves, test.key, key)
+		}
+	}
+}
+
+func TestPolyglotBook(t *testing.T) {
+	pos := engine.FromStandardStartingPosition()
+	e4, _ := engine.ParseMove(pos, "e4")
+	d4, _ := engine.ParseMove(pos, "d4")
+
+	var buf bytes.Buffer
+	entries := []engine.PolyglotEntry{
+		{Key: engine.PolyglotKey(pos), Move: engine.EncodePolyglotMove(d4), Weight: 1},
+		{Key: engine.PolyglotKey(pos), Move: engine.EncodePolyglotMove(e4), Weight: 10},
+	}
+	if err := engine.WritePolyglotBook(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 32 {
+		t.Fatalf("expected 32 bytes, got %d", buf.Len())
+	}
+
+	book, err := engine.ReadPolyglotBook(&buf)
+	if errors.Is(err, engine.ErrPolyglotKeysMissing) {
+		t.Skip("the Random64 key table is not in the tree")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if moves := book.Moves(pos); len(moves) != 2 {
+		t.Fatalf("expected 2 book moves, got %v", moves)
+	}
+	book.BestMove = true
+	if move, ok := book.Move(pos); !ok || move != e4 {
+		t.Errorf("expected the best move e4, got %v", move)
+	}
+
+	pos.MakeMove(e4)
+	if _, ok := book.Move(pos); ok {
+		t.Error("expected the position after e4 to be out of book")
+	}
+}
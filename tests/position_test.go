@@ -73,3 +73,32 @@ func positionBitboardsCorrect(pos *engine.Position) (bool, engine.Piece) {
 	}
 	return true, engine.ANoPiece()
 }
+
+// Games of any length are kept, and the FEN counters follow the moves
+func TestLongGameHistory(t *testing.T) {
+	pos, err := engine.FromFEN("4k3/8/8/8/8/8/8/1N2K1N1 w - - 0 60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := engine.FEN(pos)
+
+	// The knights shuffle back and forth 150 times
+	tour := []string{"b1c3", "e8d8", "c3b1", "d8e8"}
+	for i := 0; i < 150; i++ {
+		if err := engine.MakeUCIMoves(pos, tour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := "4k3/8/8/8/8/8/8/1N2K1N1 w - - 600 360"
+	if fen := engine.FEN(pos); fen != expected {
+		t.Errorf("expected %s, got %s", expected, fen)
+	}
+
+	for len(*pos.MoveHistory) > 0 {
+		pos.UndoMove((*pos.MoveHistory)[len(*pos.MoveHistory)-1])
+	}
+	if fen := engine.FEN(pos); fen != start {
+		t.Errorf("expected %s after undoing all moves, got %s", start, fen)
+	}
+}
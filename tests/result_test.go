@@ -0,0 +1,61 @@
+package engine_test
+
+import (
+	"tactix/engine"
+	"testing"
+)
+
+func TestGameResultFromFEN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected engine.GameResult
+	}{
+		{engine.StartingPositionFEN, engine.Ongoing},
+		{"rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", engine.BlackWins},
+		{"k7/1Q6/1K6/8/8/8/8/8 b - - 0 1", engine.WhiteWins},
+		{"k7/8/1Q6/8/8/8/8/7K b - - 0 1", engine.DrawByStalemate},
+		{"8/8/4k3/8/8/3K4/8/8 w - - 0 1", engine.DrawByInsufficientMaterial},
+		{"8/8/4k3/8/8/3K4/5B2/8 w - - 0 1", engine.DrawByInsufficientMaterial},
+		{"8/8/4k3/8/8/3K4/5N2/8 b - - 0 1", engine.DrawByInsufficientMaterial},
+		{"8/8/4k2b/8/8/3K4/5B2/8 w - - 0 1", engine.DrawByInsufficientMaterial},
+		{"8/8/4k1b1/8/8/3K4/5B2/8 w - - 0 1", engine.Ongoing},
+		{"8/8/4k3/8/8/3K4/4NN2/8 w - - 0 1", engine.Ongoing},
+		{"8/8/4k3/8/8/3K4/5R2/8 w - - 100 80", engine.DrawByFiftyMoveRule},
+		{"8/8/4k3/8/8/3K4/5R2/8 w - - 99 80", engine.Ongoing},
+	}
+
+	for _, test := range tests {
+		pos, err := engine.FromFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result := pos.GameResult(); result != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.fen, test.expected, result)
+		}
+	}
+}
+
+func TestGameResultRepetition(t *testing.T) {
+	pos := engine.FromStandardStartingPosition()
+	shuffle := []string{"g1f3", "g8f6", "f3g1", "f6g8"}
+
+	engine.MakeUCIMoves(pos, shuffle)
+	if pos.Repetitions() != 1 {
+		t.Errorf("expected 1 repetition, got %d", pos.Repetitions())
+	}
+	if pos.GameResult() != engine.Ongoing {
+		t.Errorf("twofold repetition should not end the game")
+	}
+
+	engine.MakeUCIMoves(pos, shuffle)
+	if pos.GameResult() != engine.DrawByRepetition {
+		t.Errorf("expected threefold repetition, got %s", pos.GameResult())
+	}
+
+	// A pawn move makes every earlier position unreachable
+	engine.MakeUCIMoves(pos, []string{"e2e4"})
+	if pos.Repetitions() != 0 {
+		t.Errorf("expected no repetitions after a pawn move, got %d", pos.Repetitions())
+	}
+}
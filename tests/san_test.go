@@ -0,0 +1,102 @@
+package engine_test
+
+import (
+	"errors"
+	"tactix/engine"
+	"testing"
+)
+
+func TestSAN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		uciMove  string
+		expected string
+	}{
+		{engine.StartingPositionFEN, "e2e4", "e4"},
+		{engine.StartingPositionFEN, "g1f3", "Nf3"},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/3PP3/8/PPP2PPP/RNBQKBNR w KQkq - 0 3", "d4e5", "dxe5"},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1g1", "O-O"},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "e1c1", "O-O-O"},
+		{"4k3/8/8/8/8/8/8/R4RK1 w - - 0 1", "a1d1", "Rad1"},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "h1h8", "Rh8+"},
+		{"4k3/R7/8/8/8/8/8/R3K3 w Q - 0 1", "a1a3", "R1a3"},
+		{"4k3/8/8/8/8/5Q1Q/8/4K2Q w - - 0 1", "h3g2", "Qh3g2"},
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", "a1a8", "Ra8#"},
+		{"4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", "exd6"},
+		{"2n1k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7c8q", "bxc8=Q+"},
+		{"2n1k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b7b8n", "b8=N"},
+	}
+
+	for _, test := range tests {
+		pos, err := engine.FromFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		move, err := engine.ParseUCIMove(pos, test.uciMove)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if san := pos.SAN(move); san != test.expected {
+			t.Errorf("%s %s: expected %s, got %s", test.fen, test.uciMove, test.expected, san)
+		}
+	}
+}
+
+// Every legal move is parsed back from its own SAN
+func TestParseSANRoundTrip(t *testing.T) {
+	for _, perftTest := range engine.PerftSuite {
+		pos, err := engine.FromFEN(perftTest.FEN)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, move := range engine.LegalMoves(pos) {
+			san := pos.SAN(move)
+			parsed, err := engine.ParseSAN(pos, san)
+			if err != nil {
+				t.Errorf("%s %s: %v", perftTest.FEN, san, err)
+				continue
+			}
+			if parsed != move {
+				t.Errorf("%s %s: expected %s, got %s", perftTest.FEN, san, move, parsed)
+			}
+		}
+	}
+}
+
+func TestParseSANVariants(t *testing.T) {
+	tests := []struct {
+		fen      string
+		san      string
+		expected string
+		err      error
+	}{
+		{"r3k2r/8/8/8/8/8/8/4K3 b kq - 0 1", "0-0", "e8g8", nil},
+		{"r3k2r/8/8/8/8/8/8/4K3 b kq - 0 1", "O-O-O+", "e8c8", nil},
+		{"4k3/8/8/8/8/8/8/R3K2R w KQ - 0 1", "Rh8", "h1h8", nil},
+		{"4k3/8/8/8/8/8/8/R4RK1 w - - 0 1", "Rd1", "", engine.ErrAmbiguousMove},
+		{"2n1k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8Q", "b7b8q", nil},
+		{"2n1k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "bc8=R", "b7c8r", nil},
+		{"2n1k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8", "", engine.ErrIllegalMove},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/3PP3/8/PPP2PPP/RNBQKBNR w KQkq - 0 3", "de5", "d4e5", nil},
+		{engine.StartingPositionFEN, "Nbd2", "", engine.ErrIllegalMove},
+		{engine.StartingPositionFEN, "Zf3", "", engine.ErrInvalidMove},
+	}
+
+	for _, test := range tests {
+		pos, err := engine.FromFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		move, err := engine.ParseSAN(pos, test.san)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s %s: expected error %v, got %v", test.fen, test.san, test.err, err)
+			continue
+		}
+		if err == nil && move.UCIString() != test.expected {
+			t.Errorf("%s %s: expected %s, got %s", test.fen, test.san, test.expected, move.UCIString())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package engine_test
+
+import (
+	"io"
+	"tactix/engine"
+	"testing"
+)
+
+func TestSearchFindsMate(t *testing.T) {
+	tests := []struct {
+		fen      string
+		limits   engine.SearchLimits
+		bestMove string
+		score    string
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", engine.SearchLimits{Depth: 4}, "a1a8", "mate 1"},
+		{"r5k1/8/8/8/8/8/5PPP/6K1 b - - 0 1", engine.SearchLimits{Depth: 4}, "a8a1", "mate 1"},
+		{"kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1", engine.SearchLimits{Mate: 2}, "a1a6", "mate 2"},
+		// The mate completes the fifty moves, and takes precedence over the draw
+		{"7k/8/6K1/8/8/8/8/R7 w - - 99 80", engine.SearchLimits{Depth: 4}, "a1a8", "mate 1"},
+	}
+
+	for _, test := range tests {
+		pos, err := engine.FromFEN(test.fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		search := engine.NewSearch(pos, test.limits, nil)
+		search.Search()
+
+		if search.BestMove.UCIString() != test.bestMove {
+			t.Errorf("%s: expected %s, got %s", test.fen, test.bestMove, search.BestMove.UCIString())
+		}
+		if len(search.PV) == 0 || search.PV[0] != search.BestMove {
+			t.Errorf("%s: principal variation %v does not start with the best move", test.fen, search.PV)
+		}
+		if engine.FormatScore(search.Score) != test.score {
+			t.Errorf("%s: expected score %s, got %s", test.fen, test.score, engine.FormatScore(search.Score))
+		}
+	}
+}
+
+// mirrorMove flips the ranks of a move, to play it in the mirrored position
+func mirrorMove(uciMove string) string {
+	mirrored := []byte(uciMove)
+	for _, i := range []int{1, 3} {
+		mirrored[i] = '1' + '8' - mirrored[i]
+	}
+	return string(mirrored)
+}
+
+func TestSearchTacticsForBothColors(t *testing.T) {
+	tests := []struct {
+		fen      string
+		bestMove string
+	}{
+		// Free rook
+		{"4k3/8/8/8/3r4/8/8/3QK3 w - - 0 1", "d1d4"},
+		// Knight fork of king and queen
+		{"2q3k1/8/8/3N4/8/8/P7/6K1 w - - 0 1", "d5e7"},
+		// Back rank mate
+		{"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", "a1a8"},
+		// Mate in 2
+		{"kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1", "a1a6"},
+	}
+
+	// The same win has to be found by Black in the mirrored position
+	for _, test := range tests {
+		for _, mirrored := range []bool{false, true} {
+			fen, bestMove := test.fen, test.bestMove
+			if mirrored {
+				fen, bestMove = mirrorFEN(fen), mirrorMove(bestMove)
+			}
+
+			pos, err := engine.FromFEN(fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			search := engine.NewSearch(pos, engine.SearchLimits{Depth: 4}, nil)
+			search.Search()
+
+			if search.BestMove.UCIString() != bestMove {
+				t.Errorf("%s: expected %s, got %s", fen, bestMove, search.BestMove.UCIString())
+			}
+			if search.Score <= 0 {
+				t.Errorf("%s: expected a winning score for the side to move, got %s", fen, engine.FormatScore(search.Score))
+			}
+		}
+	}
+}
+
+func TestFormatScore(t *testing.T) {
+	tests := []struct {
+		score    int
+		expected string
+	}{
+		{35, "cp 35"},
+		{-120, "cp -120"},
+		{engine.MateScore - 1, "mate 1"},
+		{engine.MateScore - 3, "mate 2"},
+		{-engine.MateScore + 2, "mate -1"},
+		{-engine.MateScore + 4, "mate -2"},
+	}
+
+	for _, test := range tests {
+		if formatted := engine.FormatScore(test.score); formatted != test.expected {
+			t.Errorf("%d: expected %s, got %s", test.score, test.expected, formatted)
+		}
+	}
+}
+
+func TestAnalyzeMultiPV(t *testing.T) {
+	pos, err := engine.FromFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := engine.Analyze(pos, 3)
+
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+	if lines[0].Move.UCIString() != "a1a8" || engine.FormatScore(lines[0].Score) != "mate 1" {
+		t.Errorf("expected a1a8 with mate 1 first, got %s %s", lines[0].Move.UCIString(), engine.FormatScore(lines[0].Score))
+	}
+
+	seen := make(map[engine.Move]bool)
+	for i, line := range lines {
+		if seen[line.Move] {
+			t.Errorf("line %d repeats the move %s", i+1, line.Move.UCIString())
+		}
+		seen[line.Move] = true
+
+		if len(line.PV) == 0 || line.PV[0] != line.Move {
+			t.Errorf("line %d: principal variation does not start with %s", i+1, line.Move.UCIString())
+		}
+		if i > 0 && line.Score > lines[i-1].Score {
+			t.Errorf("line %d scores better than the line before it", i+1)
+		}
+	}
+}
+
+// The helper threads share the transposition table, run with -race to check it
+func TestSearchThreads(t *testing.T) {
+	pos, err := engine.FromFEN("kbK5/pp6/1P6/8/8/8/8/R7 w - - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := engine.NewSearch(pos, engine.SearchLimits{Depth: 5}, nil)
+	search.Threads = 4
+	search.Output = io.Discard
+	search.Search()
+
+	if search.BestMove.UCIString() != "a1a6" || engine.FormatScore(search.Score) != "mate 2" {
+		t.Errorf("expected a1a6 with mate 2, got %s with %s", search.BestMove.UCIString(), engine.FormatScore(search.Score))
+	}
+	if search.Nodes() == 0 {
+		t.Error("no nodes counted")
+	}
+
+	// The node limit covers the nodes of the helpers too
+	pos, err = engine.FromFEN(kiwipeteFEN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	search = engine.NewSearch(pos, engine.SearchLimits{Nodes: 20_000}, nil)
+	search.Threads = 4
+	search.Output = io.Discard
+	search.Search()
+	if search.Nodes() < 20_000 || search.Nodes() > 30_000 {
+		t.Errorf("expected about 20000 nodes, got %d", search.Nodes())
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	pos, err := engine.FromFEN(kiwipeteFEN)
+	if err != nil {
+		b.Fatal(err)
+	}
+	tt := engine.NewTranspositionTable(engine.DefaultHashMB)
+
+	// The allocations are per search, none are made per node
+	b.ReportAllocs()
+	b.ResetTimer()
+	nodes := 0
+	for i := 0; i < b.N; i++ {
+		tt.Clear()
+		search := engine.NewSearch(pos, engine.SearchLimits{Nodes: 100_000}, tt)
+		search.Output = io.Discard
+		search.Search()
+		nodes += search.Nodes()
+	}
+	b.ReportMetric(float64(nodes)/float64(b.N), "nodes/op")
+}
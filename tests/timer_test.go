@@ -0,0 +1,51 @@
+package engine_test
+
+import (
+	"tactix/engine"
+	"testing"
+	"time"
+)
+
+func TestTimerAllocate(t *testing.T) {
+	tests := []struct {
+		limits   engine.SearchLimits
+		c2m      engine.Color
+		expected int64
+	}{
+		{engine.SearchLimits{}, engine.White, 0},
+		{engine.SearchLimits{Infinite: true, WTime: 1000}, engine.White, 0},
+		{engine.SearchLimits{MoveTime: 1000}, engine.Black, 1000 - engine.MoveOverhead},
+		{engine.SearchLimits{WTime: 60000, BTime: 30000}, engine.White, 60000 / engine.DefaultMovesToGo},
+		{engine.SearchLimits{WTime: 60000, BTime: 30000, BInc: 1000}, engine.Black, 30000/engine.DefaultMovesToGo + 750},
+		{engine.SearchLimits{WTime: 10000, MovesToGo: 5}, engine.White, 2000},
+		{engine.SearchLimits{WTime: 1000, MovesToGo: 1}, engine.White, 1000 - engine.MoveOverhead},
+	}
+
+	for i, test := range tests {
+		timer := engine.NewTimer()
+		timer.Allocate(test.limits, test.c2m)
+
+		if timer.TimeForMove != test.expected {
+			t.Errorf("test %d: expected %d ms, got %d ms", i, test.expected, timer.TimeForMove)
+		}
+	}
+}
+
+func TestTimerPonder(t *testing.T) {
+	timer := engine.NewTimer()
+	timer.Allocate(engine.SearchLimits{MoveTime: engine.MoveOverhead + 1, Ponder: true}, engine.White)
+	timer.Start()
+	time.Sleep(5 * time.Millisecond)
+
+	// The time is up, but it only counts once the opponent played the expected move
+	timer.Check()
+	if timer.Stopped() || !timer.CanStartIteration() {
+		t.Fatal("expected a pondering search to keep going")
+	}
+
+	timer.PonderHit()
+	timer.Check()
+	if !timer.Stopped() {
+		t.Error("expected the search to stop after ponderhit, its time was already used")
+	}
+}
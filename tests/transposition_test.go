@@ -0,0 +1,37 @@
+package engine_test
+
+import (
+	"tactix/engine"
+	"testing"
+)
+
+func TestTranspositionTableStoreProbe(t *testing.T) {
+	tt := engine.NewTranspositionTable(1)
+	pos := engine.FromStandardStartingPosition()
+	move := engine.Move{From: engine.Square(13), To: engine.Square(29), Flag: engine.PawnPush}
+
+	if _, found := tt.Probe(pos.Hash); found {
+		t.Fatal("empty table should not contain the position")
+	}
+
+	tt.Store(pos.Hash, move, 35, 4, engine.BoundExact)
+
+	entry, found := tt.Probe(pos.Hash)
+	if !found {
+		t.Fatal("stored position not found")
+	}
+	if entry.Move != move || entry.Score != 35 || entry.Depth != 4 || entry.Bound != engine.BoundExact {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	// A shallower bound must not replace a deeper result
+	tt.Store(pos.Hash, engine.NilMove(), 10, 2, engine.BoundUpper)
+	if entry, _ := tt.Probe(pos.Hash); entry.Depth != 4 {
+		t.Errorf("deeper entry was replaced by %+v", entry)
+	}
+
+	tt.Clear()
+	if _, found := tt.Probe(pos.Hash); found {
+		t.Error("position found after clearing the table")
+	}
+}
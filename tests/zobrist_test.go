@@ -0,0 +1,67 @@
+package engine_test
+
+import (
+	"tactix/engine"
+	"testing"
+)
+
+const zobristTestDepth = 3
+
+func TestZobristIncremental(t *testing.T) {
+	for _, perftTest := range engine.PerftSuite {
+		pos, err := engine.FromFEN(perftTest.FEN)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pos.Hash != pos.ComputeHash() {
+			t.Fatalf("key from FEN does not match at %s", perftTest.FEN)
+		}
+
+		walkZobrist(t, pos, min(perftTest.Depth, zobristTestDepth))
+	}
+}
+
+func walkZobrist(t *testing.T, pos *engine.Position, depth int) {
+	if depth == 0 {
+		return
+	}
+
+	moves := engine.LegalMoves(pos)
+	for i := 0; i < len(moves); i++ {
+		move := moves[i]
+		before := pos.Hash
+
+		pos.MakeMove(move)
+		if pos.Hash != pos.ComputeHash() {
+			t.Fatalf("incremental key does not match after %s at %s", move.UCIString(), engine.FEN(pos))
+		}
+
+		walkZobrist(t, pos, depth-1)
+
+		pos.UndoMove(move)
+		if pos.Hash != before {
+			t.Fatalf("key not restored after undoing %s at %s", move.UCIString(), engine.FEN(pos))
+		}
+	}
+}
+
+func TestZobristTransposition(t *testing.T) {
+	pos1 := engine.FromStandardStartingPosition()
+	pos2 := engine.FromStandardStartingPosition()
+
+	if err := engine.MakeUCIMoves(pos1, []string{"g1f3", "d7d5", "d2d4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.MakeUCIMoves(pos2, []string{"d2d4", "d7d5", "g1f3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the position after d2d4 has an en passant file, so compare once it is cleared
+	engine.MakeUCIMoves(pos1, []string{"g8f6"})
+	engine.MakeUCIMoves(pos2, []string{"g8f6"})
+
+	if pos1.Hash != pos2.Hash {
+		t.Errorf("transposed positions have different keys: %016x != %016x", pos1.Hash, pos2.Hash)
+	}
+}